@@ -1,86 +1,248 @@
 package api
 
 import (
-	"context"
-	"errors"
-	"fmt"
 	"io"
-	"os"
-
-	"github.com/Azure/azure-sdk-for-go/services/cognitiveservices/v2.0/computervision"
-	"github.com/Azure/go-autorest/autorest"
+	"sort"
+	"strings"
 )
 
-// Client object to interact with Azure Computer Vision services cleanly
-type Client struct {
-	visionClient  computervision.BaseClient
-	visionContext context.Context
-	threshold     float64
-	loud          bool
+// Candidate is a single possible description of an image.
+type Candidate struct {
+	Text       string
+	Confidence float64
+}
+
+// Details are everything besides captions that a provider found in an image.
+// They are only filled in if Config.Enrich is set.
+type Details struct {
+	Tags      []string `json:",omitempty"`
+	Objects   []string `json:",omitempty"`
+	Brands    []string `json:",omitempty"`
+	Landmarks []string `json:",omitempty"`
+	// Text is any printed text in the image, like in a screenshot.
+	Text string `json:",omitempty"`
+	// TextHeavy is set by OCR for images that are mostly text.
+	TextHeavy bool `json:",omitempty"`
 }
 
-var ErrorAuth = errors.New("no key or endpoint")
+// Empty checks if nothing besides captions was found.
+func (d *Details) Empty() bool {
+	return len(d.Tags) == 0 && len(d.Objects) == 0 && len(d.Brands) == 0 && len(d.Landmarks) == 0 && d.Text == ""
+}
 
-// New Client object
-func New(key string, endpoint string, threshold float64, loud bool) (*Client, error) {
-	if key == "" || endpoint == "" {
-		return nil, ErrorAuth
+// Description is the result of describing an image. Candidates are ranked
+// from most to least confident.
+type Description struct {
+	Candidates []Candidate
+	Details
+}
+
+// Best returns the most confident candidate.
+func (d *Description) Best() (*Candidate, error) {
+	if d == nil || len(d.Candidates) == 0 {
+		return nil, ErrorNoLabel
 	}
 
-	computerVisionKey := key
+	return &d.Candidates[0], nil
+}
+
+// Describer is anything that can describe an image stream.
+//
+// language is a BCP 47 tag like "es" or "ja-JP" to describe the image in; an
+// empty language is the provider's default. Implementations return a
+// *LanguageError for languages they can't describe in, and a
+// *ConfidenceError along with the Description if the best candidate is below
+// their confidence threshold.
+type Describer interface {
+	Describe(name string, image io.Reader, language string) (*Description, error)
+}
+
+// Config selects and configures a Describer.
+type Config struct {
+	Provider string
+	// Key and Endpoint are for Azure, which also does OCR for the other
+	// providers.
+	Key      string
+	Endpoint string
+	// LocalKey and LocalEndpoint are for the openai and ollama providers.
+	// An empty LocalEndpoint is the provider's default URL, and an empty
+	// LocalKey sends no key, so Azure's are never sent to another server.
+	LocalKey      string
+	LocalEndpoint string
+	Threshold     float64
+	Loud          bool
+	Limits        Limits
+	// Candidates is how many captions to ask for; less than 1 means 1.
+	Candidates int
+	// Enrich asks for Details along with captions, which can take more requests.
+	Enrich bool
+	// OCR names an OCR engine that reads the text in every image; empty
+	// turns OCR off.
+	OCR string
+	// MinWords is how many recognized words make an image text-heavy.
+	MinWords int
+	// Model is the model a local provider like ollama describes images
+	// with.
+	Model string
+	// Prompt is a text/template of a PromptData that asks a local provider
+	// for alt text; empty uses DefaultPrompt.
+	Prompt string
+	// MaxLength is the most characters of alt text a local provider writes;
+	// less than 1 uses DefaultMaxLength.
+	MaxLength int
+	// Fixtures is a json file of captions for the fake provider.
+	Fixtures string
+	// Record is a cassette file to record every description to.
+	Record string
+	// Replay is a cassette file to replay descriptions from instead of
+	// calling the provider.
+	Replay string
+}
+
+// DefaultProvider is used when Config.Provider is empty.
+const DefaultProvider = "azure"
 
-	endpointURL := endpoint
+type providerFunc func(config Config) (Describer, error)
 
-	client := Client{
-		visionContext: context.Background(),
-		visionClient:  computervision.New(endpointURL),
-		threshold:     threshold,
-		loud:          loud,
+var providers = map[string]providerFunc{
+	"azure":  newAzureDescriber,
+	"openai": newOpenAIDescriber,
+	"ollama": newOllamaDescriber,
+	"fake":   newFakeDescriber,
+}
+
+type modelFunc func(config Config) string
+
+// models name the model behind each provider, so cached captions record what
+// made them.
+var models = map[string]modelFunc{
+	"azure":  azureModel,
+	"openai": localModel(""),
+	"ollama": localModel(DefaultOllamaModel),
+	"fake":   fakeModel,
+}
+
+// Model names the model config.Provider describes images with.
+func Model(config Config) string {
+	provider := config.Provider
+
+	if provider == "" {
+		provider = DefaultProvider
 	}
 
-	client.visionClient.Authorizer = autorest.NewCognitiveServicesAuthorizer(computerVisionKey)
+	model, ok := models[provider]
 
-	return &client, nil
+	if !ok {
+		return ""
+	}
+
+	return model(config)
 }
 
-// Describe a local image with the highest confidence guess.
-func (c *Client) Describe(localImagePath string) (*computervision.ImageCaption, error) {
+// New returns the Describer named by config.Provider, wrapped to respect config.Limits.
+// If config.OCR is set, every image is also read by that OCR engine. If
+// config.Replay is set, descriptions are replayed from it instead, and if
+// config.Record is set they are recorded to it.
+func New(config Config) (Describer, error) {
+	provider := config.Provider
+
+	if provider == "" {
+		provider = DefaultProvider
+	}
+
+	newDescriber, ok := providers[provider]
 
-	if c.loud {
-		fmt.Printf("Trying to describe %s\n", localImagePath)
+	if !ok {
+		return nil, &ProviderError{provider}
 	}
-	var localImage io.ReadCloser
-	localImage, err := os.Open(localImagePath)
+
+	if config.Replay != "" {
+		// replaying needs neither the provider nor its credentials
+		replayer, err := NewReplayer(config.Replay, config.Threshold)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return NewLimited(replayer, config.Limits, config.Loud), nil
+	}
+
+	describer, err := newDescriber(config)
 
 	if err != nil {
 		return nil, err
 	}
 
-	maxNumberDescriptionCandidates := new(int32)
-	*maxNumberDescriptionCandidates = 1
+	provided := []interface{}{describer}
+
+	if config.OCR != "" {
+		recognizer, err := newRecognizer(config)
+
+		if err != nil {
+			return nil, err
+		}
+
+		provided = append(provided, recognizer)
+		describer = NewOCR(describer, recognizer, config.MinWords)
+	}
+
+	if config.Record != "" {
+		describer, err = NewRecorder(describer, config.Record, config.Threshold)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	limited := NewLimited(describer, config.Limits, config.Loud)
+	limited.limit(provided...)
 
-	// @TODO: check file size
+	return limited, nil
+}
+
+// baseLanguage returns the lowercase primary subtag of a BCP 47 language,
+// like "pt" for "pt-BR".
+func baseLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+
+	if i := strings.IndexAny(language, "-_"); i >= 0 {
+		return language[:i]
+	}
+
+	return language
+}
 
-	localImageDescription, err := c.visionClient.DescribeImageInStream(
-		c.visionContext,
-		localImage,
-		maxNumberDescriptionCandidates,
-		"", // language
-	)
+// rank sorts candidates from most to least confident and checks the best one
+// against threshold.
+func rank(candidates []Candidate, threshold float64) (*Description, error) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+
+	description := &Description{Candidates: candidates}
+
+	best, err := description.Best()
 
 	if err != nil {
 		return nil, err
 	}
 
-	if len(*localImageDescription.Captions) == 0 {
-		return nil, ErrorNoLabel
+	if best.Confidence < threshold {
+		return description, &ConfidenceError{best.Confidence}
 	}
 
-	imageCaption := (*localImageDescription.Captions)[0]
+	return description, nil
+}
+
+// Providers lists the names of all known providers.
+func Providers() []string {
+	names := []string{}
 
-	if *imageCaption.Confidence < c.threshold {
-		return &imageCaption, &ConfidenceError{*imageCaption.Confidence}
+	for name := range providers {
+		names = append(names, name)
 	}
 
-	return &imageCaption, nil
+	sort.Strings(names)
+
+	return names
 }
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/cognitiveservices/v2.0/computervision"
+)
+
+func TestRank(t *testing.T) {
+	candidates := []Candidate{
+		{Text: "a dog", Confidence: 0.4},
+		{Text: "a cat", Confidence: 0.8},
+	}
+
+	description, err := rank(candidates, 0.5)
+
+	if err != nil {
+		t.Fatalf("got error %s; wanted no error", err.Error())
+	}
+
+	best, _ := description.Best()
+
+	if best.Text != "a cat" {
+		t.Errorf("best candidate is %s, want a cat", best.Text)
+	}
+
+	_, err = rank(candidates, 0.9)
+
+	if _, ok := err.(*ConfidenceError); !ok {
+		t.Errorf("got error %v; wanted a *ConfidenceError", err)
+	}
+
+	_, err = rank([]Candidate{}, 0.5)
+
+	if !errors.Is(err, ErrorNoLabel) {
+		t.Errorf("got error %v; wanted %v", err, ErrorNoLabel)
+	}
+}
+
+func TestNewUnknownProvider(t *testing.T) {
+	_, err := New(Config{Provider: "nonexistent"})
+
+	if _, ok := err.(*ProviderError); !ok {
+		t.Errorf("got error %v; wanted a *ProviderError", err)
+	}
+}
+
+func TestOCRText(t *testing.T) {
+	word := func(text string) computervision.OcrWord {
+		return computervision.OcrWord{Text: &text}
+	}
+
+	result := computervision.OcrResult{Regions: &[]computervision.OcrRegion{
+		{Lines: &[]computervision.OcrLine{
+			{Words: &[]computervision.OcrWord{word("Save"), word("changes?")}},
+			{Words: &[]computervision.OcrWord{word("Cancel")}},
+		}},
+		{Lines: nil},
+	}}
+
+	if got := ocrText(result); got != "Save changes? Cancel" {
+		t.Errorf("ocrText() == %q, want %q", got, "Save changes? Cancel")
+	}
+}
+
+func TestAppendConfident(t *testing.T) {
+	client := &AzureClient{threshold: 0.5}
+
+	names := []string{}
+
+	for _, c := range []struct {
+		name       string
+		confidence float64
+	}{{"cat", 0.9}, {"dog", 0.2}, {"cat", 0.7}, {"sofa", 0.5}} {
+		name, confidence := c.name, c.confidence
+		names = client.appendConfident(names, &name, &confidence)
+	}
+
+	names = client.appendConfident(names, nil, nil)
+
+	if len(names) != 2 || names[0] != "cat" || names[1] != "sofa" {
+		t.Errorf("got %v, want [cat sofa]", names)
+	}
+}
+
+func TestAzureLanguage(t *testing.T) {
+	cases := []struct {
+		language string
+		want     string
+		ok       bool
+	}{
+		{"", "", true},
+		{"es", "es", true},
+		{"ja-JP", "ja", true},
+		{"pt_BR", "pt", true},
+		{"zh-Hant", "zh", true},
+		{"fr", "", false},
+	}
+
+	for _, c := range cases {
+		got, err := azureLanguage(c.language)
+
+		if c.ok != (err == nil) || got != c.want {
+			t.Errorf("azureLanguage(%q) == %q, %v; want %q", c.language, got, err, c.want)
+		}
+	}
+
+	if got := azureOCRLanguage("zh-Hant"); got != computervision.ZhHant {
+		t.Errorf("azureOCRLanguage(zh-Hant) == %s, want %s", got, computervision.ZhHant)
+	}
+
+	if got := azureOCRLanguage("es-MX"); got != computervision.Es {
+		t.Errorf("azureOCRLanguage(es-MX) == %s, want %s", got, computervision.Es)
+	}
+
+	if got := azureOCRLanguage("xx"); got != computervision.Unk {
+		t.Errorf("azureOCRLanguage(xx) == %s, want %s", got, computervision.Unk)
+	}
+}
+
+func TestAzureKeepsCaptionWhenEnrichingFails(t *testing.T) {
+	requests := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, path.Base(r.URL.Path))
+
+		if strings.HasSuffix(r.URL.Path, "/describe") {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"description": {"captions": [{"text": "a cat", "confidence": 0.9}]}}`))
+			return
+		}
+
+		http.Error(w, `{"error": {"code": "InvalidRequest"}}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client, err := NewAzure("key", server.URL, 0.5, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Enrich = true
+
+	description, err := client.Describe("cat.png", strings.NewReader("cat"), "")
+
+	if err != nil {
+		t.Fatalf("got error %s; wanted the caption", err.Error())
+	}
+
+	if best, _ := description.Best(); best.Text != "a cat" || !description.Details.Empty() {
+		t.Errorf("got %+v; want a cat without details", description)
+	}
+
+	if strings.Join(requests, " ") != "describe analyze" {
+		t.Errorf("made requests %v, want describe and analyze", requests)
+	}
+}
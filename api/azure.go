@@ -0,0 +1,381 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/cognitiveservices/v2.0/computervision"
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// AzureClient describes images with Azure Computer Vision services.
+type AzureClient struct {
+	visionClient  computervision.BaseClient
+	visionContext context.Context
+	threshold     float64
+	loud          bool
+	// Candidates is how many captions to ask for.
+	Candidates int32
+	// Enrich also tags the image, detects objects, brands and landmarks and
+	// reads any printed text, which takes two more requests per image.
+	Enrich bool
+	// skipText leaves reading text out of Enrich, for when OCR reads it instead.
+	skipText bool
+	// wait, if set, is called before every request but the first of Describe.
+	wait func() error
+}
+
+// NewAzure returns a new AzureClient
+func NewAzure(key string, endpoint string, threshold float64, loud bool) (*AzureClient, error) {
+	if key == "" || endpoint == "" {
+		return nil, ErrorAuth
+	}
+
+	computerVisionKey := key
+
+	endpointURL := endpoint
+
+	client := AzureClient{
+		visionContext: context.Background(),
+		visionClient:  computervision.New(endpointURL),
+		threshold:     threshold,
+		loud:          loud,
+		Candidates:    1,
+	}
+
+	client.visionClient.Authorizer = autorest.NewCognitiveServicesAuthorizer(computerVisionKey)
+
+	return &client, nil
+}
+
+// azureModel is the Computer Vision API version describing images.
+func azureModel(config Config) string {
+	return "computervision-v2.0"
+}
+
+func newAzureDescriber(config Config) (Describer, error) {
+	client, err := NewAzure(config.Key, config.Endpoint, config.Threshold, config.Loud)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Candidates > 1 {
+		client.Candidates = int32(config.Candidates)
+	}
+
+	client.Enrich = config.Enrich
+	client.skipText = config.OCR != ""
+
+	return client, nil
+}
+
+// Describe an image stream with the highest confidence guess.
+func (c *AzureClient) Describe(name string, image io.Reader, language string) (*Description, error) {
+
+	if c.loud {
+		fmt.Fprintf(os.Stderr, "Trying to describe %s\n", name)
+	}
+
+	azureLang, err := azureLanguage(language)
+
+	if err != nil {
+		return nil, err
+	}
+
+	maxNumberDescriptionCandidates := new(int32)
+	*maxNumberDescriptionCandidates = c.Candidates
+
+	if *maxNumberDescriptionCandidates < 1 {
+		*maxNumberDescriptionCandidates = 1
+	}
+
+	// @TODO: check file size
+
+	// the image is sent once per request, so it has to be read up front
+	data, err := ioutil.ReadAll(image)
+
+	if err != nil {
+		return nil, err
+	}
+
+	imageDescription, err := c.visionClient.DescribeImageInStream(
+		c.visionContext,
+		ioutil.NopCloser(bytes.NewReader(data)),
+		maxNumberDescriptionCandidates,
+		azureLang,
+	)
+
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	if imageDescription.Captions == nil {
+		return nil, ErrorNoLabel
+	}
+
+	candidates := []Candidate{}
+
+	for _, imageCaption := range *imageDescription.Captions {
+		if imageCaption.Text == nil || imageCaption.Confidence == nil {
+			continue
+		}
+
+		candidates = append(candidates, Candidate{
+			Text:       *imageCaption.Text,
+			Confidence: *imageCaption.Confidence,
+		})
+	}
+
+	details := Details{}
+
+	// enrichment is optional, so failing to enrich keeps the caption
+	if c.Enrich {
+		details, err = c.details(name, data, azureLang)
+
+		if err != nil {
+			log.Printf("Can't enrich %s; %s.\n", name, err.Error())
+			details = Details{}
+		}
+	}
+
+	description, err := rank(candidates, c.threshold)
+
+	if description != nil {
+		description.Details = details
+	}
+
+	return description, err
+}
+
+// details analyzes an image for tags, objects, brands, landmarks and text,
+// taking one request for text and one for everything else.
+func (c *AzureClient) details(name string, data []byte, language string) (Details, error) {
+	details := Details{}
+
+	if err := c.waitForRequest(); err != nil {
+		return details, err
+	}
+
+	analysis, err := c.visionClient.AnalyzeImageInStream(
+		c.visionContext,
+		ioutil.NopCloser(bytes.NewReader(data)),
+		[]computervision.VisualFeatureTypes{
+			computervision.VisualFeatureTypesTags,
+			computervision.VisualFeatureTypesObjects,
+			computervision.VisualFeatureTypesBrands,
+			computervision.VisualFeatureTypesCategories,
+		},
+		[]computervision.Details{computervision.Landmarks},
+		language,
+	)
+
+	if err != nil {
+		return details, statusError(err)
+	}
+
+	if analysis.Tags != nil {
+		for _, tag := range *analysis.Tags {
+			details.Tags = c.appendConfident(details.Tags, tag.Name, tag.Confidence)
+		}
+	}
+
+	if analysis.Objects != nil {
+		for _, object := range *analysis.Objects {
+			details.Objects = c.appendConfident(details.Objects, object.Object, object.Confidence)
+		}
+	}
+
+	if analysis.Brands != nil {
+		for _, brand := range *analysis.Brands {
+			details.Brands = c.appendConfident(details.Brands, brand.Name, brand.Confidence)
+		}
+	}
+
+	if analysis.Categories != nil {
+		for _, category := range *analysis.Categories {
+			if category.Detail == nil || category.Detail.Landmarks == nil {
+				continue
+			}
+
+			for _, landmark := range *category.Detail.Landmarks {
+				details.Landmarks = c.appendConfident(details.Landmarks, landmark.Name, landmark.Confidence)
+			}
+		}
+	}
+
+	if c.skipText {
+		return details, nil
+	}
+
+	// the text is optional, so failing to read it keeps everything else
+	text, err := c.Recognize(name, bytes.NewReader(data), language)
+
+	if err != nil {
+		log.Printf("Can't read text in %s; %s.\n", name, err.Error())
+		return details, nil
+	}
+
+	details.Text = text
+
+	return details, nil
+}
+
+func newAzureRecognizer(config Config) (Recognizer, error) {
+	return NewAzure(config.Key, config.Endpoint, config.Threshold, config.Loud)
+}
+
+// Recognize the printed text in an image stream.
+func (c *AzureClient) Recognize(name string, image io.Reader, language string) (string, error) {
+	if err := c.waitForRequest(); err != nil {
+		return "", err
+	}
+
+	ocr, err := c.visionClient.RecognizePrintedTextInStream(
+		c.visionContext,
+		true, // detect orientation
+		ioutil.NopCloser(image),
+		azureOCRLanguage(language),
+	)
+
+	if err != nil {
+		return "", statusError(err)
+	}
+
+	return ocrText(ocr), nil
+}
+
+// limitWith makes every extra request wait for wait first.
+func (c *AzureClient) limitWith(wait func() error) {
+	c.wait = wait
+}
+
+// waitForRequest waits before an extra request, if c is limited.
+func (c *AzureClient) waitForRequest() error {
+	if c.wait == nil {
+		return nil
+	}
+
+	return c.wait()
+}
+
+// appendConfident appends name if it is at least as confident as the
+// client's threshold and isn't already in names.
+func (c *AzureClient) appendConfident(names []string, name *string, confidence *float64) []string {
+	if name == nil || confidence == nil || *confidence < c.threshold {
+		return names
+	}
+
+	for _, existing := range names {
+		if existing == *name {
+			return names
+		}
+	}
+
+	return append(names, *name)
+}
+
+// ocrText joins every word recognized in an image.
+func ocrText(result computervision.OcrResult) string {
+	words := []string{}
+
+	if result.Regions == nil {
+		return ""
+	}
+
+	for _, region := range *result.Regions {
+		if region.Lines == nil {
+			continue
+		}
+
+		for _, line := range *region.Lines {
+			if line.Words == nil {
+				continue
+			}
+
+			for _, word := range *line.Words {
+				if word.Text != nil {
+					words = append(words, *word.Text)
+				}
+			}
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// azureLanguages are the languages Azure can describe images in.
+var azureLanguages = map[string]bool{"en": true, "es": true, "ja": true, "pt": true, "zh": true}
+
+// azureLanguage converts a BCP 47 language to one Azure can describe images
+// in, like "es-MX" to "es".
+func azureLanguage(language string) (string, error) {
+	if language == "" {
+		return "", nil
+	}
+
+	base := baseLanguage(language)
+
+	if !azureLanguages[base] {
+		return "", &LanguageError{Provider: "azure", Language: language}
+	}
+
+	return base, nil
+}
+
+// azureOCRLanguage converts a BCP 47 language to one Azure can read text in,
+// or Unk to detect the language.
+func azureOCRLanguage(language string) computervision.OcrLanguages {
+	language = strings.ToLower(language)
+
+	for _, ocrLanguage := range computervision.PossibleOcrLanguagesValues() {
+		if strings.ToLower(string(ocrLanguage)) == language {
+			return ocrLanguage
+		}
+	}
+
+	switch baseLanguage(language) {
+	case "zh":
+		return computervision.ZhHans
+	case "sr":
+		return computervision.SrLatn
+	}
+
+	for _, ocrLanguage := range computervision.PossibleOcrLanguagesValues() {
+		if string(ocrLanguage) == baseLanguage(language) {
+			return ocrLanguage
+		}
+	}
+
+	return computervision.Unk
+}
+
+// statusError converts an autorest error into a *StatusError when it has an HTTP status.
+func statusError(err error) error {
+	detailed, ok := err.(autorest.DetailedError)
+
+	if !ok {
+		return err
+	}
+
+	statusCode, ok := detailed.StatusCode.(int)
+
+	if !ok || statusCode == 0 {
+		return err
+	}
+
+	retryAfter := time.Duration(0)
+
+	if detailed.Response != nil {
+		retryAfter = parseRetryAfter(detailed.Response.Header.Get("Retry-After"), time.Now())
+	}
+
+	return &StatusError{StatusCode: statusCode, RetryAfter: retryAfter, Err: err}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/samuelstevens/gocaption/util"
+)
+
+// recording is a described image in a cassette.
+type recording struct {
+	Candidates []Candidate
+	Details    Details `json:",omitempty"`
+}
+
+// Cassette records what a Describer says about each image to a json file, or
+// replays it without the Describer, so runs can be repeated offline and in
+// tests. Images are keyed by their hash and language. Replayed candidates
+// are checked against the threshold of the replaying run.
+type Cassette struct {
+	// describer is nil when replaying.
+	describer Describer
+	path      string
+	threshold float64
+
+	mu         sync.Mutex
+	recordings map[string]recording
+}
+
+// NewRecorder returns a Cassette that describes images with describer and
+// records them to the json file at path, keeping anything already recorded.
+func NewRecorder(describer Describer, path string, threshold float64) (*Cassette, error) {
+	cassette, err := loadCassette(path, threshold, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cassette.describer = describer
+
+	return cassette, nil
+}
+
+// NewReplayer returns a Cassette that replays the images recorded to the
+// json file at path. Images that weren't recorded return a *CassetteError.
+func NewReplayer(path string, threshold float64) (*Cassette, error) {
+	return loadCassette(path, threshold, false)
+}
+
+func loadCassette(path string, threshold float64, missingOK bool) (*Cassette, error) {
+	cassette := Cassette{path: path, threshold: threshold, recordings: map[string]recording{}}
+
+	data, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) && missingOK {
+		return &cassette, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &cassette.recordings); err != nil {
+		return nil, fmt.Errorf("can't parse cassette %s: %s", path, err.Error())
+	}
+
+	return &cassette, nil
+}
+
+// cassetteKey is where an image in a language is recorded.
+func cassetteKey(hash string, language string) string {
+	if language == "" {
+		return hash
+	}
+
+	return hash + "@" + strings.ToLower(language)
+}
+
+// Describe an image by replaying its recording, or by describing and
+// recording it.
+func (c *Cassette) Describe(name string, image io.Reader, language string) (*Description, error) {
+	data, err := ioutil.ReadAll(image)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := util.HashReader(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := cassetteKey(hash, language)
+
+	if c.describer == nil {
+		c.mu.Lock()
+		recorded, ok := c.recordings[key]
+		c.mu.Unlock()
+
+		if !ok {
+			return nil, &CassetteError{Path: c.path, Name: name}
+		}
+
+		return c.replay(recorded)
+	}
+
+	description, err := c.describer.Describe(name, bytes.NewReader(data), language)
+
+	if _, ok := err.(*ConfidenceError); err != nil && !ok {
+		return nil, err
+	}
+
+	if description == nil {
+		return nil, err
+	}
+
+	if saveErr := c.record(key, recording{description.Candidates, description.Details}); saveErr != nil {
+		return nil, saveErr
+	}
+
+	return description, err
+}
+
+// replay ranks a copy of a recording, so it can't be changed by callers.
+func (c *Cassette) replay(recorded recording) (*Description, error) {
+	candidates := append([]Candidate{}, recorded.Candidates...)
+
+	description, err := rank(candidates, c.threshold)
+
+	if description != nil {
+		description.Details = recorded.Details
+	}
+
+	return description, err
+}
+
+// record adds a recording and rewrites the cassette.
+func (c *Cassette) record(key string, recorded recording) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.recordings[key] = recorded
+
+	data, err := json.MarshalIndent(c.recordings, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	return util.WriteFileAtomic(c.path, data, 0644)
+}
@@ -3,6 +3,8 @@ package api
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // ConfidenceError indicates that Azure could not find a caption with a high confidence.
@@ -16,3 +18,66 @@ func (e *ConfidenceError) Error() string {
 
 // ErrorNoLabel indicates that Azure could not find any captions for the path.
 var ErrorNoLabel = errors.New("no descriptions found")
+
+// ProviderError indicates that a captioning provider isn't known.
+type ProviderError struct {
+	Provider string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("unknown provider %q (known: %s)", e.Provider, strings.Join(Providers(), ", "))
+}
+
+// OCREngineError indicates that an OCR engine isn't known.
+type OCREngineError struct {
+	Engine string
+}
+
+func (e *OCREngineError) Error() string {
+	return fmt.Sprintf("unknown OCR engine %q (known: %s)", e.Engine, strings.Join(OCREngines(), ", "))
+}
+
+// LanguageError indicates that a provider can't describe images in a language.
+type LanguageError struct {
+	Provider string
+	Language string
+}
+
+func (e *LanguageError) Error() string {
+	return fmt.Sprintf("%s can't describe images in %q", e.Provider, e.Language)
+}
+
+// ErrorAuth indicates that a provider is missing its credentials.
+var ErrorAuth = errors.New("no key or endpoint")
+
+// ErrorModel indicates that a local provider doesn't know which model to use.
+var ErrorModel = errors.New("no model")
+
+// ErrorBudget indicates that the per-run request budget is used up.
+var ErrorBudget = errors.New("request budget exceeded")
+
+// StatusError is an unsuccessful HTTP response from a provider.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Err.Error())
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// CassetteError indicates that an image wasn't recorded to a cassette being
+// replayed.
+type CassetteError struct {
+	Path string
+	Name string
+}
+
+func (e *CassetteError) Error() string {
+	return fmt.Sprintf("%s isn't recorded in cassette %s", e.Name, e.Path)
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/samuelstevens/gocaption/util"
+)
+
+// fakeConfidence is the confidence of a fake caption that doesn't set one.
+const fakeConfidence = 0.9
+
+// Fixture is a fake caption. In a fixture file it is either just the text or
+// an object like {"text": "a cat", "confidence": 0.4}.
+type Fixture struct {
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence"`
+}
+
+// UnmarshalJSON reads a Fixture from a string or an object.
+func (f *Fixture) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &f.Text); err == nil {
+		f.Confidence = fakeConfidence
+		return nil
+	}
+
+	type fixture Fixture
+
+	parsed := fixture{Confidence: fakeConfidence}
+
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+
+	*f = Fixture(parsed)
+
+	return nil
+}
+
+// Fake describes images without calling any service, for tests and demos.
+// Images are looked up in Fixtures by their hash, their name or their base
+// name, with "@language" for a language, and otherwise captioned from their
+// file name, like "a black cat" for "a-black_cat.png".
+type Fake struct {
+	Fixtures  map[string]Fixture
+	threshold float64
+	loud      bool
+}
+
+// NewFake returns a Fake that reads its fixtures from fixtureFile, a json
+// object of hashes or file names to captions. An empty fixtureFile captions
+// every image from its file name.
+func NewFake(fixtureFile string, threshold float64, loud bool) (*Fake, error) {
+	fake := Fake{Fixtures: map[string]Fixture{}, threshold: threshold, loud: loud}
+
+	if fixtureFile == "" {
+		return &fake, nil
+	}
+
+	data, err := ioutil.ReadFile(fixtureFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &fake.Fixtures); err != nil {
+		return nil, fmt.Errorf("can't parse fixtures %s: %s", fixtureFile, err.Error())
+	}
+
+	return &fake, nil
+}
+
+func newFakeDescriber(config Config) (Describer, error) {
+	return NewFake(config.Fixtures, config.Threshold, config.Loud)
+}
+
+// fakeModel is the fixture file captions come from.
+func fakeModel(config Config) string {
+	if config.Fixtures == "" {
+		return "filename"
+	}
+
+	return "fixtures:" + filepath.Base(config.Fixtures)
+}
+
+// Describe an image with its fixture, or from its file name.
+func (f *Fake) Describe(name string, image io.Reader, language string) (*Description, error) {
+	if f.loud {
+		fmt.Fprintf(os.Stderr, "Trying to describe %s\n", name)
+	}
+
+	data, err := ioutil.ReadAll(image)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := util.HashReader(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	fixture, ok := f.fixture([]string{hash, name, path.Base(filepath.ToSlash(name))}, language)
+
+	if !ok {
+		fixture = Fixture{Text: fileNameCaption(name), Confidence: fakeConfidence}
+	}
+
+	if fixture.Text == "" {
+		return nil, ErrorNoLabel
+	}
+
+	return rank([]Candidate{{Text: fixture.Text, Confidence: fixture.Confidence}}, f.threshold)
+}
+
+// fixture finds the first of keys in Fixtures, preferring one for language.
+func (f *Fake) fixture(keys []string, language string) (Fixture, bool) {
+	if language != "" {
+		for _, key := range keys {
+			if fixture, ok := f.Fixtures[key+"@"+strings.ToLower(language)]; ok {
+				return fixture, true
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if fixture, ok := f.Fixtures[key]; ok {
+			return fixture, true
+		}
+	}
+
+	return Fixture{}, false
+}
+
+// fileNameCaption makes a caption from a file name, like "a black cat" for
+// "/img/a-black_cat.png".
+func fileNameCaption(name string) string {
+	base := path.Base(filepath.ToSlash(name))
+	base = strings.TrimSuffix(base, path.Ext(base))
+
+	return strings.Join(strings.FieldsFunc(base, func(r rune) bool {
+		return r == '-' || r == '_' || r == '.' || r == ' ' || r == '+'
+	}), " ")
+}
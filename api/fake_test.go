@@ -0,0 +1,144 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samuelstevens/gocaption/util"
+)
+
+func TestFake(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fake")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	hash, _ := util.HashReader(strings.NewReader("dog"))
+	fixtures := `{
+		"` + hash + `": "a dog",
+		"cat.png": {"text": "a cat", "confidence": 0.3},
+		"cat.png@es": "un gato",
+		"blank.png": ""
+	}`
+
+	fixtureFile := filepath.Join(dir, "fixtures.json")
+
+	if err := ioutil.WriteFile(fixtureFile, []byte(fixtures), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fake, err := NewFake(fixtureFile, 0.5, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name       string
+		contents   string
+		language   string
+		want       string
+		confidence float64
+	}{
+		{"/site/img/pet.jpg", "dog", "", "a dog", fakeConfidence},
+		{"/site/img/cat.png", "cat", "", "a cat", 0.3},
+		{"/site/img/cat.png", "cat", "ES", "un gato", fakeConfidence},
+		{"/site/img/a-black_cat.final.png", "?", "", "a black cat final", fakeConfidence},
+	}
+
+	for _, c := range cases {
+		description, err := fake.Describe(c.name, strings.NewReader(c.contents), c.language)
+
+		if _, ok := err.(*ConfidenceError); err != nil && !ok {
+			t.Errorf("Describe(%s) failed: %s", c.name, err)
+			continue
+		}
+
+		if (c.confidence < 0.5) != (err != nil) {
+			t.Errorf("Describe(%s) returned error %v for confidence %f", c.name, err, c.confidence)
+		}
+
+		best, _ := description.Best()
+
+		if best.Text != c.want || best.Confidence != c.confidence {
+			t.Errorf("Describe(%s) == %+v, want %q with confidence %f", c.name, best, c.want, c.confidence)
+		}
+	}
+
+	if _, err := fake.Describe("blank.png", strings.NewReader("?"), ""); err != ErrorNoLabel {
+		t.Errorf("got error %v; wanted %v for an empty fixture", err, ErrorNoLabel)
+	}
+
+	if _, err := New(Config{Provider: "fake", Fixtures: filepath.Join(dir, "missing.json")}); err == nil {
+		t.Errorf("a missing fixture file should fail")
+	}
+}
+
+func TestCassette(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cassette.json")
+	fake := &Fake{Fixtures: map[string]Fixture{"cat.png": {Text: "a cat", Confidence: 0.6}}}
+
+	recorder, err := NewRecorder(fake, path, 0.5)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, language := range []string{"", "es"} {
+		if _, err := recorder.Describe("cat.png", strings.NewReader("cat"), language); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replayer, err := NewReplayer(path, 0.5)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file name doesn't matter when replaying, only the image
+	description, err := replayer.Describe("other.png", strings.NewReader("cat"), "ES")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if best, _ := description.Best(); best.Text != "a cat" {
+		t.Errorf("replayed %+v, want a cat", best)
+	}
+
+	strict, err := NewReplayer(path, 0.9)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := strict.Describe("cat.png", strings.NewReader("cat"), ""); err == nil {
+		t.Errorf("replaying should check the threshold of the replaying run")
+	}
+
+	if _, err := replayer.Describe("dog.png", strings.NewReader("dog"), ""); err == nil {
+		t.Errorf("replaying an image that wasn't recorded should fail")
+	} else if _, ok := err.(*CassetteError); !ok {
+		t.Errorf("got error %v; wanted a *CassetteError", err)
+	}
+
+	// replaying doesn't need the provider's credentials
+	if _, err := New(Config{Provider: "azure", Replay: path}); err != nil {
+		t.Errorf("replaying failed without credentials: %s", err)
+	}
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// baseBackoff is how long to wait before the first retry.
+	baseBackoff = time.Second
+	// maxBackoff caps how long to wait between retries.
+	maxBackoff = time.Minute
+)
+
+// Limits configures how often a Limited Describer calls its provider.
+// Zero values mean no limit.
+type Limits struct {
+	PerSecond   float64
+	PerMinute   float64
+	MaxRequests int
+	MaxRetries  int
+}
+
+// Limited wraps a Describer with client-side rate limiting, a request budget
+// and retries with exponential backoff.
+type Limited struct {
+	describer Describer
+	limits    Limits
+	interval  time.Duration
+	loud      bool
+
+	mu       sync.Mutex
+	next     time.Time
+	requests int
+	retries  int
+	random   *rand.Rand
+
+	sleep func(time.Duration)
+	now   func() time.Time
+}
+
+// multiRequester is a Describer or Recognizer that makes more requests than
+// the one Limited waits for, and waits for each extra one with wait.
+type multiRequester interface {
+	limitWith(wait func() error)
+}
+
+// NewLimited returns a Limited Describer
+func NewLimited(describer Describer, limits Limits, loud bool) *Limited {
+	interval := time.Duration(0)
+
+	if limits.PerSecond > 0 {
+		interval = time.Duration(float64(time.Second) / limits.PerSecond)
+	}
+
+	if limits.PerMinute > 0 {
+		perMinute := time.Duration(float64(time.Minute) / limits.PerMinute)
+
+		if perMinute > interval {
+			interval = perMinute
+		}
+	}
+
+	return &Limited{
+		describer: describer,
+		limits:    limits,
+		interval:  interval,
+		loud:      loud,
+		random:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		sleep:     time.Sleep,
+		now:       time.Now,
+	}
+}
+
+// Describe an image, waiting for the rate limit and retrying transient errors.
+func (l *Limited) Describe(name string, image io.Reader, language string) (*Description, error) {
+	// keep the image around so it can be sent again
+	data, err := ioutil.ReadAll(image)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := l.wait(); err != nil {
+			return nil, err
+		}
+
+		description, err := l.describer.Describe(name, bytes.NewReader(data), language)
+
+		if !retryable(err) || attempt >= l.limits.MaxRetries {
+			return description, err
+		}
+
+		delay := l.backoff(attempt, err)
+
+		if l.loud {
+			fmt.Fprintf(os.Stderr, "Retrying %s in %s (retry %d of %d); %s\n", name, delay, attempt+1, l.limits.MaxRetries, err.Error())
+		}
+
+		l.mu.Lock()
+		l.retries++
+		l.mu.Unlock()
+
+		l.sleep(delay)
+	}
+}
+
+// limit makes every extra request the clients make wait for the rate limit
+// and count against the budget.
+func (l *Limited) limit(clients ...interface{}) {
+	for _, client := range clients {
+		if requester, ok := client.(multiRequester); ok {
+			requester.limitWith(l.wait)
+		}
+	}
+}
+
+// Retries returns how many times requests have been retried.
+func (l *Limited) Retries() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.retries
+}
+
+// Requests returns how many requests have been made.
+func (l *Limited) Requests() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.requests
+}
+
+// wait blocks until the next request is allowed by the rate limit.
+func (l *Limited) wait() error {
+	l.mu.Lock()
+
+	if l.limits.MaxRequests > 0 && l.requests >= l.limits.MaxRequests {
+		l.mu.Unlock()
+		return ErrorBudget
+	}
+
+	l.requests++
+
+	now := l.now()
+	start := now
+
+	if l.next.After(start) {
+		start = l.next
+	}
+
+	l.next = start.Add(l.interval)
+
+	l.mu.Unlock()
+
+	if start.After(now) {
+		l.sleep(start.Sub(now))
+	}
+
+	return nil
+}
+
+// backoff returns how long to wait before retrying. It honors Retry-After, up
+// to maxBackoff, and otherwise doubles the wait for every attempt, with jitter.
+func (l *Limited) backoff(attempt int, err error) time.Duration {
+	var statusErr *StatusError
+
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		if statusErr.RetryAfter > maxBackoff {
+			return maxBackoff
+		}
+
+		return statusErr.RetryAfter
+	}
+
+	delay := baseBackoff << uint(attempt)
+
+	if delay > maxBackoff || delay <= 0 {
+		delay = maxBackoff
+	}
+
+	l.mu.Lock()
+	jitter := time.Duration(l.random.Int63n(int64(delay)/2 + 1))
+	l.mu.Unlock()
+
+	return delay/2 + jitter
+}
+
+// retryable reports whether err is worth trying again.
+func retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var statusErr *StatusError
+
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+
+		return false
+	}
+
+	// dropped connections are as transient as timeouts
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
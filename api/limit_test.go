@@ -0,0 +1,242 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyDescriber fails with errs in order before succeeding.
+type flakyDescriber struct {
+	errs   []error
+	images []string
+}
+
+func (d *flakyDescriber) Describe(name string, image io.Reader, language string) (*Description, error) {
+	data, _ := ioutil.ReadAll(image)
+	d.images = append(d.images, string(data))
+
+	if len(d.errs) > 0 {
+		err := d.errs[0]
+		d.errs = d.errs[1:]
+		return nil, err
+	}
+
+	return &Description{Candidates: []Candidate{{Text: "a cat", Confidence: 0.9}}}, nil
+}
+
+func newTestLimited(describer Describer, limits Limits) (*Limited, *[]time.Duration) {
+	sleeps := []time.Duration{}
+
+	limited := NewLimited(describer, limits, false)
+	limited.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+	}
+
+	return limited, &sleeps
+}
+
+func TestLimitedRetries(t *testing.T) {
+	throttled := &StatusError{StatusCode: 429, RetryAfter: 7 * time.Second, Err: errors.New("throttled")}
+	unavailable := &StatusError{StatusCode: 503, Err: errors.New("unavailable")}
+
+	describer := &flakyDescriber{errs: []error{throttled, unavailable}}
+	limited, sleeps := newTestLimited(describer, Limits{MaxRetries: 3})
+
+	description, err := limited.Describe("cat.png", strings.NewReader("cat"), "")
+
+	if err != nil {
+		t.Fatalf("got error %s; wanted no error", err.Error())
+	}
+
+	if best, _ := description.Best(); best.Text != "a cat" {
+		t.Errorf("got %s, want a cat", best.Text)
+	}
+
+	if limited.Retries() != 2 {
+		t.Errorf("got %d retries, want 2", limited.Retries())
+	}
+
+	if (*sleeps)[0] != 7*time.Second {
+		t.Errorf("first retry waited %s, want Retry-After of 7s", (*sleeps)[0])
+	}
+
+	if (*sleeps)[1] < baseBackoff || (*sleeps)[1] > 2*baseBackoff {
+		t.Errorf("second retry waited %s, want between %s and %s", (*sleeps)[1], baseBackoff, 2*baseBackoff)
+	}
+
+	for _, image := range describer.images {
+		if image != "cat" {
+			t.Errorf("retried with image %q, want %q", image, "cat")
+		}
+	}
+}
+
+func TestLimitedGivesUp(t *testing.T) {
+	cases := []struct {
+		err      error
+		attempts int
+	}{
+		{err: &StatusError{StatusCode: 500, Err: errors.New("oops")}, attempts: 3},
+		{err: &StatusError{StatusCode: 400, Err: errors.New("bad image")}, attempts: 1},
+		{err: errors.New("unknown"), attempts: 1},
+	}
+
+	for _, c := range cases {
+		describer := &flakyDescriber{errs: []error{c.err, c.err, c.err, c.err}}
+		limited, _ := newTestLimited(describer, Limits{MaxRetries: 2})
+
+		_, err := limited.Describe("cat.png", strings.NewReader("cat"), "")
+
+		if err != c.err {
+			t.Errorf("got error %v; wanted %v", err, c.err)
+		}
+
+		if len(describer.images) != c.attempts {
+			t.Errorf("%v: made %d attempts, want %d", c.err, len(describer.images), c.attempts)
+		}
+	}
+}
+
+func TestLimitedCapsRetryAfter(t *testing.T) {
+	throttled := &StatusError{StatusCode: 429, RetryAfter: time.Hour, Err: errors.New("throttled")}
+	wrapped := fmt.Errorf("describing: %w", throttled)
+
+	describer := &flakyDescriber{errs: []error{wrapped}}
+	limited, sleeps := newTestLimited(describer, Limits{MaxRetries: 1})
+
+	if _, err := limited.Describe("cat.png", strings.NewReader("cat"), ""); err != nil {
+		t.Fatalf("got error %s; wanted no error", err.Error())
+	}
+
+	if (*sleeps)[0] != maxBackoff {
+		t.Errorf("retry waited %s, want %s", (*sleeps)[0], maxBackoff)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	reset := &url.Error{Op: "Post", URL: "http://localhost", Err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}}
+
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil, want: false},
+		{err: fmt.Errorf("describing: %w", &StatusError{StatusCode: 503, Err: errors.New("unavailable")}), want: true},
+		{err: fmt.Errorf("describing: %w", &StatusError{StatusCode: 401, Err: errors.New("unauthorized")}), want: false},
+		{err: reset, want: true},
+		{err: &url.Error{Op: "Post", URL: "http://localhost", Err: io.ErrUnexpectedEOF}, want: true},
+		{err: errors.New("unknown"), want: false},
+	}
+
+	for _, c := range cases {
+		if got := retryable(c.err); got != c.want {
+			t.Errorf("retryable(%v) = %t; want %t", c.err, got, c.want)
+		}
+	}
+}
+
+func TestLimitedRate(t *testing.T) {
+	limited, sleeps := newTestLimited(&flakyDescriber{}, Limits{PerSecond: 10, PerMinute: 30, MaxRequests: 3})
+
+	now := time.Now()
+	limited.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := limited.Describe("cat.png", strings.NewReader("cat"), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the per minute limit is stricter, so requests are 2s apart
+	want := []time.Duration{2 * time.Second, 4 * time.Second}
+
+	if len(*sleeps) != len(want) {
+		t.Fatalf("slept %v, want %v", *sleeps, want)
+	}
+
+	for i := range want {
+		if (*sleeps)[i] != want[i] {
+			t.Errorf("slept %v, want %v", *sleeps, want)
+		}
+	}
+
+	if _, err := limited.Describe("cat.png", strings.NewReader("cat"), ""); err != ErrorBudget {
+		t.Errorf("got error %v; wanted %v", err, ErrorBudget)
+	}
+}
+
+// enrichingDescriber makes extra requests for every image, like enriched
+// Azure descriptions.
+type enrichingDescriber struct {
+	extra int
+	wait  func() error
+}
+
+func (d *enrichingDescriber) limitWith(wait func() error) {
+	d.wait = wait
+}
+
+func (d *enrichingDescriber) Describe(name string, image io.Reader, language string) (*Description, error) {
+	for i := 0; i < d.extra; i++ {
+		if err := d.wait(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Description{Candidates: []Candidate{{Text: "a cat", Confidence: 0.9}}}, nil
+}
+
+func TestLimitedCountsExtraRequests(t *testing.T) {
+	describer := &enrichingDescriber{extra: 2}
+	limited, sleeps := newTestLimited(describer, Limits{PerSecond: 1, MaxRequests: 4})
+	limited.limit(describer)
+
+	now := time.Now()
+	limited.now = func() time.Time { return now }
+
+	if _, err := limited.Describe("cat.png", strings.NewReader("cat"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if limited.Requests() != 3 {
+		t.Errorf("got %d requests, want 3", limited.Requests())
+	}
+
+	if len(*sleeps) != 2 {
+		t.Errorf("slept %v, want a wait before each extra request", *sleeps)
+	}
+
+	if _, err := limited.Describe("cat.png", strings.NewReader("cat"), ""); err != ErrorBudget {
+		t.Errorf("got error %v; wanted %v", err, ErrorBudget)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		header string
+		want   time.Duration
+	}{
+		{header: "", want: 0},
+		{header: "12", want: 12 * time.Second},
+		{header: "Mon, 01 Jun 2020 12:00:30 GMT", want: 30 * time.Second},
+		{header: "soon", want: 0},
+	}
+
+	for _, c := range cases {
+		got := parseRetryAfter(c.header, now)
+
+		if got != c.want {
+			t.Errorf("parseRetryAfter(%q) = %s; want %s", c.header, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// DefaultPrompt asks a vision model for alt text. It is a text/template
+	// of a PromptData.
+	DefaultPrompt = `Write alt text for this image for someone using a screen reader. ` +
+		`Describe what matters about the image in one short sentence of at most {{.MaxLength}} characters. ` +
+		`Don't start with "image of" or "picture of", and don't guess at text you can't read. ` +
+		`{{with .Language}}Write it in the language with the BCP 47 tag "{{.}}". {{end}}` +
+		`Reply with only the alt text.`
+	// DefaultMaxLength is the most characters of alt text a local model writes.
+	DefaultMaxLength = 150
+	// localTimeout is how long to wait for a local model, which can be slow
+	// on modest hardware.
+	localTimeout = 2 * time.Minute
+	// localConfidence is the confidence of a caption from a model that
+	// doesn't report one.
+	localConfidence = 0.9
+	// hedgeConfidence is the most confidence a caption that hedges, like "it
+	// might be a cat", gets.
+	hedgeConfidence = 0.5
+)
+
+// PromptData is what a prompt template can use.
+type PromptData struct {
+	// Language is a BCP 47 tag like "es", or empty for the model's default.
+	Language  string
+	MaxLength int
+}
+
+var (
+	// refusalPattern matches answers that aren't a caption at all.
+	refusalPattern = regexp.MustCompile(`(?i)^(i'?m sorry|sorry|i can(no|')t|i am unable|i'?m unable|unable to|as an ai)`)
+	// hedgePattern matches captions the model isn't sure of.
+	hedgePattern = regexp.MustCompile(`(?i)\b(possibly|perhaps|maybe|might be|may be|appears to be|seems to be|unclear|hard to tell|difficult to tell|blurry)\b`)
+	// labelPattern matches labels models like to put before the alt text.
+	labelPattern = regexp.MustCompile(`(?i)^(alt(ernative)? text|alt|caption|description)\s*:\s*`)
+)
+
+// localClient is what the clients of self-hosted vision model servers share.
+type localClient struct {
+	// Client makes the requests; its timeout should allow for slow models.
+	Client    *http.Client
+	baseURL   string
+	key       string
+	model     string
+	prompt    *template.Template
+	maxLength int
+	threshold float64
+	loud      bool
+}
+
+func newLocalClient(config Config, defaultURL string, defaultModel string) (*localClient, error) {
+	baseURL := config.LocalEndpoint
+
+	if baseURL == "" {
+		baseURL = defaultURL
+	}
+
+	model := config.Model
+
+	if model == "" {
+		model = defaultModel
+	}
+
+	if model == "" {
+		return nil, ErrorModel
+	}
+
+	promptText := config.Prompt
+
+	if promptText == "" {
+		promptText = DefaultPrompt
+	}
+
+	prompt, err := template.New("prompt").Parse(promptText)
+
+	if err != nil {
+		return nil, err
+	}
+
+	maxLength := config.MaxLength
+
+	if maxLength < 1 {
+		maxLength = DefaultMaxLength
+	}
+
+	return &localClient{
+		Client:    &http.Client{Timeout: localTimeout},
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		key:       config.LocalKey,
+		model:     model,
+		prompt:    prompt,
+		maxLength: maxLength,
+		threshold: config.Threshold,
+		loud:      config.Loud,
+	}, nil
+}
+
+// renderPrompt builds the prompt for an image in language.
+func (c *localClient) renderPrompt(language string) (string, error) {
+	var builder strings.Builder
+
+	err := c.prompt.Execute(&builder, PromptData{Language: language, MaxLength: c.maxLength})
+
+	return builder.String(), err
+}
+
+// maxTokens is a generous token limit for maxLength characters, so answers
+// are cut off by cleanAlt rather than the server.
+func (c *localClient) maxTokens() int {
+	return c.maxLength/2 + 32
+}
+
+// post sends a JSON request to path and decodes the JSON response into out.
+func (c *localClient) post(path string, in interface{}, out interface{}) error {
+	body, err := json.Marshal(in)
+
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	if c.key != "" {
+		request.Header.Set("Authorization", "Bearer "+c.key)
+	}
+
+	response, err := c.Client.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return &StatusError{
+			StatusCode: response.StatusCode,
+			RetryAfter: parseRetryAfter(response.Header.Get("Retry-After"), time.Now()),
+			Err:        fmt.Errorf("%s", strings.TrimSpace(string(data))),
+		}
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+// candidate turns a model's answer into a Candidate. logprobs are the log
+// probabilities of the answer's tokens, if the server reported them.
+func (c *localClient) candidate(answer string, logprobs []float64) (Candidate, bool) {
+	text := cleanAlt(answer, c.maxLength)
+
+	if text == "" || refusalPattern.MatchString(text) {
+		return Candidate{}, false
+	}
+
+	return Candidate{Text: text, Confidence: localAltConfidence(text, logprobs)}, true
+}
+
+// cleanAlt trims the quotes, labels and line breaks models put around alt
+// text, and cuts it to at most maxLength characters at a word boundary.
+func cleanAlt(answer string, maxLength int) string {
+	quotes := "\"'`“”‘’ "
+
+	text := strings.Trim(strings.Join(strings.Fields(answer), " "), quotes)
+	text = strings.Trim(labelPattern.ReplaceAllString(text, ""), quotes)
+
+	runes := []rune(text)
+
+	if len(runes) <= maxLength {
+		return text
+	}
+
+	cut := string(runes[:maxLength])
+
+	if space := strings.LastIndex(cut, " "); space > len(cut)/2 {
+		cut = cut[:space]
+	}
+
+	return strings.TrimRight(cut, " ,;:")
+}
+
+// localAltConfidence maps a model's answer to a confidence. The geometric
+// mean probability of its tokens is used if the server reported them,
+// otherwise a fixed confidence; either way captions that hedge are capped.
+func localAltConfidence(text string, logprobs []float64) float64 {
+	confidence := localConfidence
+
+	if len(logprobs) > 0 {
+		sum := 0.0
+
+		for _, logprob := range logprobs {
+			sum += logprob
+		}
+
+		confidence = math.Exp(sum / float64(len(logprobs)))
+	}
+
+	if hedgePattern.MatchString(text) && confidence > hedgeConfidence {
+		confidence = hedgeConfidence
+	}
+
+	return confidence
+}
+
+// localModel is the model a local provider describes images with.
+func localModel(defaultModel string) modelFunc {
+	return func(config Config) string {
+		if config.Model == "" {
+			return defaultModel
+		}
+
+		return config.Model
+	}
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAI(t *testing.T) {
+	var got openAIRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.NotFound(w, r)
+			return
+		}
+
+		json.NewDecoder(r.Body).Decode(&got)
+
+		w.Write([]byte(`{"choices": [
+			{"message": {"content": "A dog, maybe."}},
+			{"message": {"content": "\"Alt text: A cat asleep on a keyboard\"\n"}, "logprobs": {"content": [{"logprob": -0.1}, {"logprob": -0.3}]}}
+		]}`))
+	}))
+	defer server.Close()
+
+	client, err := NewOpenAI(Config{LocalEndpoint: server.URL + "/v1/", LocalKey: "secret", Model: "qwen-vl", Candidates: 2, Threshold: 0.5})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	description, err := client.Describe("cat.png", strings.NewReader("\x89PNG\r\n\x1a\ncat"), "es")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Model != "qwen-vl" || got.N != 2 || len(got.Messages) != 1 || len(got.Messages[0].Content) != 2 {
+		t.Fatalf("unexpected request %+v", got)
+	}
+
+	if prompt := got.Messages[0].Content[0].Text; !strings.Contains(prompt, `"es"`) || !strings.Contains(prompt, "150 characters") {
+		t.Errorf("prompt %q should ask for Spanish and at most 150 characters", prompt)
+	}
+
+	wantURL := "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\ncat"))
+
+	if image := got.Messages[0].Content[1].ImageURL; image == nil || image.URL != wantURL {
+		t.Errorf("got image %+v, want %s", image, wantURL)
+	}
+
+	best, _ := description.Best()
+
+	if best.Text != "A cat asleep on a keyboard" || math.Abs(best.Confidence-math.Exp(-0.2)) > 1e-9 {
+		t.Errorf("best candidate is %+v, want the cat with its token probability", best)
+	}
+
+	if len(description.Candidates) != 2 || description.Candidates[1].Confidence != hedgeConfidence {
+		t.Errorf("got candidates %+v, want the hedging dog second", description.Candidates)
+	}
+}
+
+func TestOllama(t *testing.T) {
+	var got ollamaRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/generate" {
+			http.NotFound(w, r)
+			return
+		}
+
+		json.NewDecoder(r.Body).Decode(&got)
+
+		w.Write([]byte(`{"response": " A red bicycle leaning against a brick wall. ", "done": true}`))
+	}))
+	defer server.Close()
+
+	client, err := NewOllama(Config{LocalEndpoint: server.URL, Prompt: "Describe this in {{.MaxLength}} characters.", MaxLength: 20})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	description, err := client.Describe("bike.jpg", strings.NewReader("bike"), "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Model != DefaultOllamaModel || got.Stream || got.Prompt != "Describe this in 20 characters." {
+		t.Errorf("unexpected request %+v", got)
+	}
+
+	if len(got.Images) != 1 || got.Images[0] != base64.StdEncoding.EncodeToString([]byte("bike")) {
+		t.Errorf("got images %v, want the image in base64", got.Images)
+	}
+
+	best, _ := description.Best()
+
+	if best.Text != "A red bicycle" || best.Confidence != localConfidence {
+		t.Errorf("best candidate is %+v, want the bicycle cut to 20 characters", best)
+	}
+}
+
+func TestLocalErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.RawQuery, "busy") {
+			w.Header().Set("Retry-After", "3")
+			http.Error(w, "model is loading", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte(`{"response": "I'm sorry, I can't help with that."}`))
+	}))
+	defer server.Close()
+
+	client, err := NewOllama(Config{LocalEndpoint: server.URL})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Describe("a.png", strings.NewReader("a"), ""); !errors.Is(err, ErrorNoLabel) {
+		t.Errorf("got error %v; wanted %v for a refusal", err, ErrorNoLabel)
+	}
+
+	client.baseURL = server.URL + "?busy"
+
+	_, err = client.Describe("a.png", strings.NewReader("a"), "")
+
+	if statusErr, ok := err.(*StatusError); !ok || statusErr.StatusCode != http.StatusServiceUnavailable || !retryable(err) {
+		t.Errorf("got error %v; wanted a retryable *StatusError", err)
+	}
+
+	if _, err := NewOpenAI(Config{}); err != ErrorModel {
+		t.Errorf("got error %v; wanted %v without a model", err, ErrorModel)
+	}
+
+	if _, err := NewOllama(Config{Prompt: "{{.Nope"}); err == nil {
+		t.Errorf("a prompt that isn't a template should fail")
+	}
+}
+
+func TestLocalIgnoresAzureConfig(t *testing.T) {
+	azure := Config{Endpoint: "https://westus.api.cognitive.microsoft.com", Key: "azure-key", Model: "qwen-vl"}
+
+	ollama, err := NewOllama(azure)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	openAI, err := NewOpenAI(azure)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ollama.baseURL != DefaultOllamaURL || ollama.key != "" {
+		t.Errorf("ollama uses %s with key %q, want %s without a key", ollama.baseURL, ollama.key, DefaultOllamaURL)
+	}
+
+	if openAI.baseURL != DefaultOpenAIURL || openAI.key != "" {
+		t.Errorf("openai uses %s with key %q, want %s without a key", openAI.baseURL, openAI.key, DefaultOpenAIURL)
+	}
+}
+
+func TestCleanAlt(t *testing.T) {
+	cases := []struct {
+		answer string
+		want   string
+	}{
+		{"A cat.", "A cat."},
+		{"  \"A cat\"\n", "A cat"},
+		{"Alt text: A cat", "A cat"},
+		{"Caption:\n\n“A cat on a mat”", "A cat on a mat"},
+		{"A very long caption about a cat", "A very long"},
+	}
+
+	for _, c := range cases {
+		if got := cleanAlt(c.answer, 15); got != c.want {
+			t.Errorf("cleanAlt(%q) == %q, want %q", c.answer, got, c.want)
+		}
+	}
+}
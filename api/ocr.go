@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// DefaultMinWords is how many recognized words make an image text-heavy when
+// Config.MinWords is 0.
+const DefaultMinWords = 8
+
+// Recognizer is anything that can read the printed text in an image stream.
+// language is a hint like for Describer; an empty language means any.
+type Recognizer interface {
+	Recognize(name string, image io.Reader, language string) (string, error)
+}
+
+type recognizerFunc func(config Config) (Recognizer, error)
+
+var recognizers = map[string]recognizerFunc{
+	"azure":     newAzureRecognizer,
+	"tesseract": newTesseractRecognizer,
+}
+
+// OCREngines lists the names of all known OCR engines.
+func OCREngines() []string {
+	names := []string{}
+
+	for name := range recognizers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// newRecognizer returns the Recognizer named by config.OCR.
+func newRecognizer(config Config) (Recognizer, error) {
+	newRecognizer, ok := recognizers[config.OCR]
+
+	if !ok {
+		return nil, &OCREngineError{config.OCR}
+	}
+
+	return newRecognizer(config)
+}
+
+// OCR is a Describer that also reads the text in every image, so that
+// screenshots and diagrams can be described by what they say.
+type OCR struct {
+	describer  Describer
+	recognizer Recognizer
+	minWords   int
+}
+
+// NewOCR returns an OCR Describer. Images with at least minWords recognized
+// words, or whose caption already says they hold text, are text-heavy.
+func NewOCR(describer Describer, recognizer Recognizer, minWords int) *OCR {
+	if minWords < 1 {
+		minWords = DefaultMinWords
+	}
+
+	return &OCR{describer, recognizer, minWords}
+}
+
+// Describe an image, filling in its Details.Text and Details.TextHeavy.
+func (o *OCR) Describe(name string, image io.Reader, language string) (*Description, error) {
+	// the image is read by both the describer and the recognizer
+	data, err := ioutil.ReadAll(image)
+
+	if err != nil {
+		return nil, err
+	}
+
+	description, describeErr := o.describer.Describe(name, bytes.NewReader(data), language)
+
+	if _, ok := describeErr.(*ConfidenceError); describeErr != nil && !ok {
+		return nil, describeErr
+	}
+
+	if description == nil {
+		return nil, ErrorNoLabel
+	}
+
+	// reading text is optional, so failing to read it keeps the caption
+	text, err := o.recognizer.Recognize(name, bytes.NewReader(data), language)
+
+	if err != nil {
+		log.Printf("Can't read text in %s; %s.\n", name, err.Error())
+		return description, describeErr
+	}
+
+	text = strings.Join(strings.Fields(text), " ")
+
+	if text != "" {
+		description.Text = text
+	}
+
+	description.TextHeavy = o.textHeavy(description)
+
+	return description, describeErr
+}
+
+// textWords are words in a caption that suggest an image is mostly text.
+var textWords = []string{"screenshot", "text", "document", "diagram", "chart", "letter", "sign", "menu", "website"}
+
+// textHeavy guesses if an image is mostly text.
+func (o *OCR) textHeavy(description *Description) bool {
+	if description.Text == "" {
+		return false
+	}
+
+	if len(strings.Fields(description.Text)) >= o.minWords {
+		return true
+	}
+
+	best, err := description.Best()
+
+	if err != nil {
+		return false
+	}
+
+	for _, word := range strings.Fields(strings.ToLower(best.Text)) {
+		for _, textWord := range textWords {
+			if strings.TrimRight(word, "s.,") == textWord {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Tesseract recognizes text locally with the tesseract command.
+type Tesseract struct {
+	// Command is the path of the tesseract binary.
+	Command string
+	// Language is a tesseract language like "eng" or "eng+jpn". If it is
+	// empty the language passed to Recognize is used, or else tesseract's
+	// default.
+	Language string
+}
+
+// tesseractLanguages maps BCP 47 languages to tesseract's traineddata names.
+var tesseractLanguages = map[string]string{
+	"ar": "ara", "de": "deu", "en": "eng", "es": "spa", "fr": "fra", "hi": "hin",
+	"it": "ita", "ja": "jpn", "ko": "kor", "nl": "nld", "pl": "pol", "pt": "por",
+	"ru": "rus", "sv": "swe", "tr": "tur", "zh": "chi_sim", "zh-hant": "chi_tra",
+}
+
+// tesseractLanguage finds the tesseract language for a BCP 47 language,
+// always including English since screenshots so often have some.
+func tesseractLanguage(language string) string {
+	language = strings.ToLower(language)
+
+	tesseract, ok := tesseractLanguages[language]
+
+	if !ok {
+		tesseract, ok = tesseractLanguages[baseLanguage(language)]
+	}
+
+	if !ok || tesseract == "eng" {
+		return ""
+	}
+
+	return tesseract + "+eng"
+}
+
+func newTesseractRecognizer(config Config) (Recognizer, error) {
+	return &Tesseract{Command: "tesseract"}, nil
+}
+
+// Recognize text by piping an image through tesseract.
+func (t *Tesseract) Recognize(name string, image io.Reader, language string) (string, error) {
+	args := []string{"stdin", "stdout"}
+
+	lang := t.Language
+
+	if lang == "" {
+		lang = tesseractLanguage(language)
+	}
+
+	if lang != "" {
+		args = append(args, "-l", lang)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(t.Command, args...)
+	cmd.Stdin = image
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseract failed on %s: %s (%s)", name, err.Error(), strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
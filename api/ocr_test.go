@@ -0,0 +1,168 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+type fixedDescriber struct {
+	text string
+	err  error
+}
+
+func (d *fixedDescriber) Describe(name string, image io.Reader, language string) (*Description, error) {
+	ioutil.ReadAll(image)
+
+	return &Description{Candidates: []Candidate{{Text: d.text, Confidence: 0.9}}}, d.err
+}
+
+type fixedRecognizer struct {
+	text string
+	read string
+	err  error
+}
+
+func (r *fixedRecognizer) Recognize(name string, image io.Reader, language string) (string, error) {
+	data, err := ioutil.ReadAll(image)
+	r.read = string(data)
+
+	if r.err != nil {
+		return "", r.err
+	}
+
+	return r.text, err
+}
+
+func TestOCR(t *testing.T) {
+	cases := []struct {
+		caption   string
+		text      string
+		textHeavy bool
+	}{
+		{"a cat sitting on a sofa", "", false},
+		{"a cat sitting on a sofa", "ACME", false},
+		{"a screenshot of a computer", "$ go test", true},
+		{"a close up of a sign", "STOP", true},
+		{"a man in a suit", "one two three four five six seven eight", true},
+	}
+
+	for _, c := range cases {
+		recognizer := &fixedRecognizer{text: c.text}
+		ocr := NewOCR(&fixedDescriber{text: c.caption}, recognizer, 0)
+
+		description, err := ocr.Describe("image.png", strings.NewReader("image bytes"), "")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if recognizer.read != "image bytes" {
+			t.Errorf("recognizer read %q, want the whole image", recognizer.read)
+		}
+
+		if description.Text != c.text {
+			t.Errorf("Text == %q, want %q", description.Text, c.text)
+		}
+
+		if description.TextHeavy != c.textHeavy {
+			t.Errorf("%q with text %q: TextHeavy == %v, want %v", c.caption, c.text, description.TextHeavy, c.textHeavy)
+		}
+	}
+}
+
+func TestOCRKeepsConfidenceError(t *testing.T) {
+	confidenceErr := &ConfidenceError{Confidence: 0.1}
+	ocr := NewOCR(&fixedDescriber{text: "a screenshot", err: confidenceErr}, &fixedRecognizer{text: "hi"}, 0)
+
+	description, err := ocr.Describe("image.png", strings.NewReader("image bytes"), "")
+
+	if !errors.Is(err, confidenceErr) || description == nil || !description.TextHeavy {
+		t.Errorf("got %+v, %v; want a text-heavy description and the confidence error", description, err)
+	}
+}
+
+func TestOCRFailureKeepsCaption(t *testing.T) {
+	recognizer := &fixedRecognizer{err: errors.New("tesseract not found")}
+	ocr := NewOCR(&fixedDescriber{text: "a screenshot"}, recognizer, 0)
+
+	description, err := ocr.Describe("image.png", strings.NewReader("image bytes"), "")
+
+	if err != nil {
+		t.Fatalf("got error %s; wanted the plain caption", err.Error())
+	}
+
+	if best, _ := description.Best(); best.Text != "a screenshot" || description.Text != "" || description.TextHeavy {
+		t.Errorf("got %+v; want the plain caption", description)
+	}
+}
+
+func TestTesseract(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script")
+	}
+
+	dir, err := ioutil.TempDir("", "tesseract")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	// a stand-in for tesseract that "recognizes" the image as its own bytes
+	command := filepath.Join(dir, "tesseract")
+	script := "#!/bin/sh\n[ \"$1 $2 $3 $4\" = \"stdin stdout -l jpn\" ] || exit 1\ncat\n"
+
+	if err := ioutil.WriteFile(command, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tesseract := &Tesseract{Command: command, Language: "jpn"}
+
+	text, err := tesseract.Recognize("image.png", strings.NewReader("こんにちは"), "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if text != "こんにちは" {
+		t.Errorf("Recognize() == %q, want %q", text, "こんにちは")
+	}
+
+	tesseract.Language = "eng"
+
+	if _, err := tesseract.Recognize("image.png", strings.NewReader("hello"), ""); err == nil {
+		t.Errorf("a failing tesseract should return an error")
+	}
+}
+
+func TestTesseractLanguage(t *testing.T) {
+	cases := map[string]string{
+		"":        "",
+		"en-US":   "",
+		"ja":      "jpn+eng",
+		"es-MX":   "spa+eng",
+		"zh-Hant": "chi_tra+eng",
+		"xx":      "",
+	}
+
+	for language, want := range cases {
+		if got := tesseractLanguage(language); got != want {
+			t.Errorf("tesseractLanguage(%q) == %q, want %q", language, got, want)
+		}
+	}
+}
+
+func TestNewUnknownOCREngine(t *testing.T) {
+	_, err := New(Config{Key: "key", Endpoint: "https://example.com", OCR: "nope"})
+
+	if _, ok := err.(*OCREngineError); !ok {
+		t.Errorf("got %v, want an *OCREngineError", err)
+	}
+}
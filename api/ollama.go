@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	// DefaultOllamaURL is where Ollama listens when Config.LocalEndpoint
+	// is empty.
+	DefaultOllamaURL = "http://localhost:11434"
+	// DefaultOllamaModel is the vision model Ollama uses when Config.Model is
+	// empty.
+	DefaultOllamaModel = "llava"
+)
+
+// OllamaClient describes images with a vision model served by Ollama's
+// /api/generate endpoint.
+type OllamaClient struct {
+	*localClient
+}
+
+type ollamaRequest struct {
+	Model   string        `json:"model"`
+	Prompt  string        `json:"prompt"`
+	Images  []string      `json:"images"`
+	Stream  bool          `json:"stream"`
+	Options ollamaOptions `json:"options"`
+}
+
+type ollamaOptions struct {
+	NumPredict int `json:"num_predict"`
+}
+
+type ollamaResponse struct {
+	Response string `json:"response"`
+}
+
+// NewOllama returns a new OllamaClient.
+func NewOllama(config Config) (*OllamaClient, error) {
+	client, err := newLocalClient(config, DefaultOllamaURL, DefaultOllamaModel)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &OllamaClient{client}, nil
+}
+
+func newOllamaDescriber(config Config) (Describer, error) {
+	return NewOllama(config)
+}
+
+// Describe an image stream with the model's answer to the prompt. Ollama
+// gives one answer per request and doesn't report how confident it is.
+func (c *OllamaClient) Describe(name string, image io.Reader, language string) (*Description, error) {
+	if c.loud {
+		fmt.Fprintf(os.Stderr, "Trying to describe %s\n", name)
+	}
+
+	data, err := ioutil.ReadAll(image)
+
+	if err != nil {
+		return nil, err
+	}
+
+	prompt, err := c.renderPrompt(language)
+
+	if err != nil {
+		return nil, err
+	}
+
+	request := ollamaRequest{
+		Model:   c.model,
+		Prompt:  prompt,
+		Images:  []string{base64.StdEncoding.EncodeToString(data)},
+		Options: ollamaOptions{NumPredict: c.maxTokens()},
+	}
+
+	response := ollamaResponse{}
+
+	if err := c.post("/api/generate", request, &response); err != nil {
+		return nil, err
+	}
+
+	candidates := []Candidate{}
+
+	if candidate, ok := c.candidate(response.Response, nil); ok {
+		candidates = append(candidates, candidate)
+	}
+
+	return rank(candidates, c.threshold)
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// DefaultOpenAIURL is the base URL of an OpenAI-compatible server, like vLLM,
+// when Config.LocalEndpoint is empty.
+const DefaultOpenAIURL = "http://localhost:8000/v1"
+
+// OpenAIClient describes images with a vision model behind an
+// OpenAI-compatible chat completions endpoint, like a self-hosted vLLM or
+// llama.cpp server.
+type OpenAIClient struct {
+	*localClient
+	// Candidates is how many captions to ask for.
+	Candidates int
+}
+
+type openAIRequest struct {
+	Model     string          `json:"model"`
+	Messages  []openAIMessage `json:"messages"`
+	MaxTokens int             `json:"max_tokens"`
+	N         int             `json:"n,omitempty"`
+	Logprobs  bool            `json:"logprobs"`
+}
+
+type openAIMessage struct {
+	Role    string          `json:"role"`
+	Content []openAIContent `json:"content"`
+}
+
+type openAIContent struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		Logprobs *struct {
+			Content []struct {
+				Logprob float64 `json:"logprob"`
+			} `json:"content"`
+		} `json:"logprobs"`
+	} `json:"choices"`
+}
+
+// NewOpenAI returns a new OpenAIClient.
+func NewOpenAI(config Config) (*OpenAIClient, error) {
+	client, err := newLocalClient(config, DefaultOpenAIURL, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &OpenAIClient{localClient: client, Candidates: config.Candidates}, nil
+}
+
+func newOpenAIDescriber(config Config) (Describer, error) {
+	return NewOpenAI(config)
+}
+
+// Describe an image stream with the model's answers to the prompt.
+func (c *OpenAIClient) Describe(name string, image io.Reader, language string) (*Description, error) {
+	if c.loud {
+		fmt.Fprintf(os.Stderr, "Trying to describe %s\n", name)
+	}
+
+	data, err := ioutil.ReadAll(image)
+
+	if err != nil {
+		return nil, err
+	}
+
+	prompt, err := c.renderPrompt(language)
+
+	if err != nil {
+		return nil, err
+	}
+
+	imageURL := "data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data)
+
+	request := openAIRequest{
+		Model: c.model,
+		Messages: []openAIMessage{{
+			Role: "user",
+			Content: []openAIContent{
+				{Type: "text", Text: prompt},
+				{Type: "image_url", ImageURL: &openAIImageURL{URL: imageURL}},
+			},
+		}},
+		MaxTokens: c.maxTokens(),
+		Logprobs:  true,
+	}
+
+	if c.Candidates > 1 {
+		request.N = c.Candidates
+	}
+
+	response := openAIResponse{}
+
+	if err := c.post("/chat/completions", request, &response); err != nil {
+		return nil, err
+	}
+
+	candidates := []Candidate{}
+
+	for _, choice := range response.Choices {
+		logprobs := []float64{}
+
+		if choice.Logprobs != nil {
+			for _, token := range choice.Logprobs.Content {
+				logprobs = append(logprobs, token.Logprob)
+			}
+		}
+
+		if candidate, ok := c.candidate(choice.Message.Content, logprobs); ok {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	return rank(candidates, c.threshold)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/samuelstevens/gocaption/audit"
+	"github.com/samuelstevens/gocaption/cli"
+)
+
+// auditCommand runs "gocaption audit" and returns the exit status.
+func auditCommand(opts *cli.AuditOptions) int {
+	failOn, err := audit.ParseSeverity(opts.FailOn)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	if len(opts.Files) == 0 {
+		fmt.Println("Please supply file(s) or directory.")
+		return 2
+	}
+
+	counts := map[audit.Severity]int{}
+	failed := 0
+	unaudited := 0
+
+	for _, path := range opts.Files {
+		findings, err := audit.File(path, audit.Options{MaxLength: opts.MaxAltLength})
+
+		if err != nil {
+			log.Printf("Can't audit %s; %s.\n", path, err.Error())
+
+			// only pages can be audited, but any page has to be
+			if _, ok := err.(*audit.FileTypeError); !ok {
+				unaudited++
+			}
+
+			continue
+		}
+
+		for _, finding := range findings {
+			counts[finding.Severity]++
+
+			if !opts.Silent {
+				fmt.Printf("%s: %s: %s: %s [%s]\n", path, finding.Severity, finding.Src, finding.Message, finding.Rule)
+			}
+		}
+
+		failed += audit.Count(findings, failOn)
+	}
+
+	fmt.Printf("%d error(s), %d warning(s) and %d note(s) in %d file(s).\n", counts[audit.Error], counts[audit.Warning], counts[audit.Note], len(opts.Files))
+
+	if unaudited > 0 {
+		fmt.Printf("Couldn't audit %d file(s).\n", unaudited)
+	}
+
+	// a file that can't be audited can't pass the audit either
+	if failed > 0 || unaudited > 0 {
+		return 1
+	}
+
+	return 0
+}
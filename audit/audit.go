@@ -0,0 +1,234 @@
+// Package audit finds images without good text alternatives in pages, without
+// captioning anything.
+package audit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/samuelstevens/gocaption/filetype"
+	"github.com/samuelstevens/gocaption/markdown"
+	"github.com/samuelstevens/gocaption/webpage"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// What a Finding is about.
+const (
+	// MissingAlt images have no alt attribute.
+	MissingAlt = "missing-alt"
+	// EmptyAlt images have a blank alt, but aren't decorative, like an
+	// image that is all a link holds.
+	EmptyAlt = "empty-alt"
+	// FileNameAlt images have their file name for an alt.
+	FileNameAlt = "filename-alt"
+	// LongAlt images have an alt longer than Options.MaxLength.
+	LongAlt = "long-alt"
+	// DuplicateAlt images have the same alt as the image right before them.
+	DuplicateAlt = "duplicate-alt"
+	// InputMissingAlt image buttons (<input type=image>) have no alt.
+	InputMissingAlt = "input-missing-alt"
+	// AreaMissingAlt image map links (<area href>) have no alt.
+	AreaMissingAlt = "area-missing-alt"
+	// SVGMissingTitle inline SVGs have no <title> or aria-label.
+	SVGMissingTitle = "svg-missing-title"
+)
+
+// severities is how much each kind of Finding matters.
+var severities = map[string]Severity{
+	MissingAlt:      Error,
+	EmptyAlt:        Error,
+	FileNameAlt:     Warning,
+	LongAlt:         Note,
+	DuplicateAlt:    Note,
+	InputMissingAlt: Error,
+	AreaMissingAlt:  Error,
+	SVGMissingTitle: Warning,
+}
+
+// Finding is a problem with an image in a page.
+type Finding struct {
+	Rule     string
+	Severity Severity
+	// Src is the image, or the element's tag for elements that aren't
+	// images, like "<svg>".
+	Src     string
+	Alt     string
+	Message string
+}
+
+func newFinding(rule string, src string, alt string, format string, args ...interface{}) Finding {
+	return Finding{rule, severities[rule], src, alt, fmt.Sprintf(format, args...)}
+}
+
+// Options changes what counts as a Finding.
+type Options struct {
+	// MaxLength is the most characters an alt should have.
+	MaxLength int
+}
+
+// DefaultMaxLength is the most characters an alt should have, unless
+// Options.MaxLength says otherwise. Screen readers read long alts in one go,
+// so longer descriptions belong in the page.
+const DefaultMaxLength = 150
+
+// File audits an HTML, XHTML or Markdown file.
+func File(path string, opts Options) ([]Finding, error) {
+	contents, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch filetype.Detect(path) {
+	case filetype.HTML, filetype.XHTML:
+		return HTML(string(contents), opts)
+	case filetype.Markdown:
+		return Markdown(string(contents), opts)
+	}
+
+	return nil, &FileTypeError{path}
+}
+
+// auditor collects the findings in a document.
+type auditor struct {
+	opts     Options
+	findings []Finding
+}
+
+// checkAlt checks the alt of an image that isn't decorative. prevAlt is the
+// alt of the image right before it, if there is one.
+func (a *auditor) checkAlt(src string, alt string, hasAlt bool, prevAlt string) {
+	maxLength := a.opts.MaxLength
+
+	if maxLength <= 0 {
+		maxLength = DefaultMaxLength
+	}
+
+	trimmed := strings.TrimSpace(alt)
+
+	switch {
+	case !hasAlt:
+		a.add(newFinding(MissingAlt, src, alt, "image has no alt"))
+	case trimmed == "":
+		a.add(newFinding(EmptyAlt, src, alt, "image has a blank alt, but isn't decorative"))
+	case webpage.IsFileName(src, alt):
+		a.add(newFinding(FileNameAlt, src, alt, "alt %q is a file name", trimmed))
+	case utf8.RuneCountInString(trimmed) > maxLength:
+		a.add(newFinding(LongAlt, src, alt, "alt is %d characters; keep it under %d", utf8.RuneCountInString(trimmed), maxLength))
+	case strings.EqualFold(trimmed, strings.TrimSpace(prevAlt)):
+		a.add(newFinding(DuplicateAlt, src, alt, "alt %q is the same as the image before it", trimmed))
+	}
+}
+
+func (a *auditor) add(finding Finding) {
+	a.findings = append(a.findings, finding)
+}
+
+// HTML audits an HTML document. Images that gocaption comments say to
+// ignore aren't audited, but images marked data-gocaption="skip" are.
+func HTML(input string, opts Options) ([]Finding, error) {
+	doc, err := html.Parse(strings.NewReader(input))
+
+	if err != nil {
+		return nil, err
+	}
+
+	a := auditor{opts: opts, findings: []Finding{}}
+
+	webpage.Walk(doc, webpage.MissingOnly, func(n *html.Node, skipped string) {
+		if skipped == webpage.SkipIgnored {
+			return
+		}
+
+		switch n.DataAtom {
+		case atom.Img, atom.Image:
+			a.checkImage(n, skipped)
+		case atom.Input:
+			if typ, _ := getAttr(n, "type"); strings.EqualFold(strings.TrimSpace(typ), "image") && !labeled(n) {
+				src, _ := getAttr(n, "src")
+				a.add(newFinding(InputMissingAlt, src, "", "image button has no alt"))
+			}
+		case atom.Area:
+			if _, isLink := getAttr(n, "href"); isLink && !labeled(n) {
+				href, _ := getAttr(n, "href")
+				a.add(newFinding(AreaMissingAlt, href, "", "image map link has no alt"))
+			}
+		case atom.Svg:
+			if !hidden(n) && !titled(n) {
+				a.add(newFinding(SVGMissingTitle, "<svg>", "", "inline SVG has no <title>"))
+			}
+		}
+	})
+
+	return a.findings, nil
+}
+
+func (a *auditor) checkImage(n *html.Node, skipped string) {
+	alt, hasAlt := getAttr(n, "alt")
+	src, _ := getAttr(n, "src")
+
+	if skipped == webpage.SkipDecorative {
+		// an image that is all a link or button holds names it
+		if alt == "" && namesControl(n) {
+			a.add(newFinding(EmptyAlt, src, alt, "image is all its link has, so its alt can't be empty"))
+		}
+
+		return
+	}
+
+	if !hasAlt {
+		if label, _ := getAttr(n, "aria-label"); strings.TrimSpace(label) != "" {
+			alt, hasAlt = label, true
+		} else if _, ok := getAttr(n, "aria-labelledby"); ok {
+			return
+		}
+	}
+
+	prevAlt := ""
+
+	if prev := previousImage(n); prev != nil {
+		prevAlt, _ = getAttr(prev, "alt")
+	}
+
+	a.checkAlt(src, alt, hasAlt, prevAlt)
+}
+
+// Markdown audits a Markdown document. Inline <img> tags only get the checks
+// of Markdown images, and neither is checked for duplicate alts.
+func Markdown(input string, opts Options) ([]Finding, error) {
+	a := auditor{opts: opts, findings: []Finding{}}
+
+	// a Markdown image can't tell a missing alt from an empty one, and
+	// MissingOnly asks for both, so only images with an alt are skipped
+	_, err := markdown.LabelImagesSkipping(input, webpage.MissingOnly, func(src string, alt string) string {
+		a.checkAlt(src, alt, false, "")
+		return ""
+	}, func(src string, alt string, reason string) {
+		if reason == webpage.SkipHasAlt {
+			a.checkAlt(src, alt, true, "")
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a.findings, nil
+}
+
+// Count counts the findings at or above a severity.
+func Count(findings []Finding, min Severity) int {
+	count := 0
+
+	for _, finding := range findings {
+		if finding.Severity >= min {
+			count++
+		}
+	}
+
+	return count
+}
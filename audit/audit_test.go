@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+)
+
+func rules(findings []Finding) string {
+	names := []string{}
+
+	for _, finding := range findings {
+		names = append(names, finding.Rule)
+	}
+
+	return strings.Join(names, " ")
+}
+
+func TestHTML(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{`<img src="cat.png">`, MissingAlt},
+		{`<img src="cat.png" alt="">`, ""},
+		{`<img src="cat.png" alt="  ">`, EmptyAlt},
+		{`<img src="cat.png" role="presentation">`, ""},
+		{`<img src="cat.png" aria-label="a cat">`, ""},
+		{`<a href="/"><img src="logo.png" alt=""></a>`, EmptyAlt},
+		{`<a href="/">Home <img src="logo.png" alt=""></a>`, ""},
+		{`<a href="/" aria-label="Home"><img src="logo.png" alt=""></a>`, ""},
+		{`<button><img src="x.png" alt=""></button>`, EmptyAlt},
+		{`<img src="img/cat.png" alt="cat">`, FileNameAlt},
+		{`<img src="cat.png" alt="IMG_1234.JPG">`, FileNameAlt},
+		{`<img src="cat.png" alt="` + strings.Repeat("a cat ", 30) + `">`, LongAlt},
+		{`<img src="a.png" alt="a cat"> <img src="b.png" alt="A cat">`, DuplicateAlt},
+		{`<a href="a"><img src="a.png" alt="a cat"></a><a href="b"><img src="b.png" alt="a cat"></a>`, DuplicateAlt},
+		{`<img src="a.png" alt="a cat"><p>more</p><img src="b.png" alt="a cat">`, ""},
+		{`<input type="image" src="go.png">`, InputMissingAlt},
+		{`<input type="image" src="go.png" alt="Go">`, ""},
+		{`<map><area href="/a"><area shape="default"></map>`, AreaMissingAlt},
+		{`<svg><path/></svg>`, SVGMissingTitle},
+		{`<svg><title>Sales by month</title></svg>`, ""},
+		{`<svg aria-hidden="true"></svg>`, ""},
+		{`<!-- gocaption:ignore-next --><img src="cat.png">`, ""},
+		{`<!-- gocaption:off --><img src="cat.png"><svg></svg><!-- gocaption:on -->`, ""},
+		{`<img src="cat.png" data-gocaption="skip">`, MissingAlt},
+	}
+
+	for _, c := range cases {
+		findings, err := HTML(c.input, Options{})
+
+		if err != nil {
+			t.Errorf("HTML(%q) failed: %s", c.input, err)
+			continue
+		}
+
+		if got := rules(findings); got != c.want {
+			t.Errorf("HTML(%q) found %q, want %q", c.input, got, c.want)
+		}
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	input := "![](cat.png)\n![dog](dog.png)\n![a dog](dog.png)\n<img src=\"x.png\" alt=\"\">\n`![](code.png)`\n"
+
+	findings, err := Markdown(input, Options{MaxLength: 4})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := rules(findings), "missing-alt filename-alt long-alt"; got != want {
+		t.Errorf("Markdown found %q, want %q", got, want)
+	}
+}
+
+func TestMarkdownDirectives(t *testing.T) {
+	input := "<!-- gocaption:ignore-next -->\n![](a.png)\n<!-- gocaption:off -->\n![](b.png) <img src=\"c.png\">\n<!-- gocaption:on -->\n![](d.png)\n"
+
+	findings, err := Markdown(input, Options{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(findings) != 1 || findings[0].Src != "d.png" {
+		t.Errorf("Markdown found %+v, want only d.png's missing alt", findings)
+	}
+}
+
+func TestCount(t *testing.T) {
+	findings, _ := HTML(`<img src="a.png"><img src="b.png" alt="b.png"><svg></svg>`, Options{})
+
+	for severity, want := range map[Severity]int{Error: 1, Warning: 3, Note: 3} {
+		if got := Count(findings, severity); got != want {
+			t.Errorf("Count(%s) == %d, want %d", severity, got, want)
+		}
+	}
+
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Errorf("ParseSeverity should reject unknown severities")
+	}
+}
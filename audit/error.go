@@ -0,0 +1,21 @@
+package audit
+
+import "fmt"
+
+// SeverityError occurs when a severity name isn't known
+type SeverityError struct {
+	name string
+}
+
+func (e *SeverityError) Error() string {
+	return fmt.Sprintf("%q is not a severity (note, warning or error)", e.name)
+}
+
+// FileTypeError occurs when a file isn't HTML, XHTML or Markdown
+type FileTypeError struct {
+	path string
+}
+
+func (e *FileTypeError) Error() string {
+	return fmt.Sprintf("%s is not an HTML or Markdown file", e.path)
+}
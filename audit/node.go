@@ -0,0 +1,169 @@
+package audit
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func getAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+
+	return "", false
+}
+
+// labeled checks if an element has a non-blank alt, aria-label or
+// aria-labelledby.
+func labeled(n *html.Node) bool {
+	for _, key := range []string{"alt", "aria-label", "aria-labelledby"} {
+		if val, _ := getAttr(n, key); strings.TrimSpace(val) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hidden checks if an element is hidden from screen readers.
+func hidden(n *html.Node) bool {
+	if val, _ := getAttr(n, "aria-hidden"); strings.EqualFold(strings.TrimSpace(val), "true") {
+		return true
+	}
+
+	role, _ := getAttr(n, "role")
+
+	switch strings.ToLower(strings.TrimSpace(role)) {
+	case "presentation", "none":
+		return true
+	}
+
+	return false
+}
+
+// titled checks if an inline SVG has a non-blank <title> as its first
+// element, or is labeled another way.
+func titled(n *html.Node) bool {
+	if labeled(n) {
+		return true
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && strings.EqualFold(child.Data, "title") {
+			return strings.TrimSpace(text(child)) != ""
+		}
+	}
+
+	return false
+}
+
+// text returns all of the text under n.
+func text(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+
+	var builder strings.Builder
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		builder.WriteString(text(child))
+	}
+
+	return builder.String()
+}
+
+// ignorable checks if a node can be left out when deciding what is next to
+// what: whitespace, comments and the <source>s of a <picture>.
+func ignorable(n *html.Node) bool {
+	switch n.Type {
+	case html.CommentNode:
+		return true
+	case html.TextNode:
+		return strings.TrimSpace(n.Data) == ""
+	}
+
+	return n.DataAtom == atom.Source
+}
+
+// wrapper checks if n is a link or <picture> whose only content is child.
+func wrapper(n *html.Node, child *html.Node) bool {
+	if n == nil || (n.DataAtom != atom.A && n.DataAtom != atom.Picture) {
+		return false
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c != child && !ignorable(c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// onlyChild returns the only child of n that can't be ignored, or nil.
+func onlyChild(n *html.Node) *html.Node {
+	var only *html.Node
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if ignorable(c) {
+			continue
+		}
+
+		if only != nil {
+			return nil
+		}
+
+		only = c
+	}
+
+	return only
+}
+
+// previousImage returns the image right before an image, with nothing but
+// whitespace between them, or nil. An image that is all a link or <picture>
+// holds stands for the link or <picture>.
+func previousImage(n *html.Node) *html.Node {
+	for wrapper(n.Parent, n) {
+		n = n.Parent
+	}
+
+	prev := n.PrevSibling
+
+	for prev != nil && ignorable(prev) {
+		prev = prev.PrevSibling
+	}
+
+	for prev != nil && prev.Type == html.ElementNode {
+		if prev.DataAtom == atom.Img || prev.DataAtom == atom.Image {
+			return prev
+		}
+
+		child := onlyChild(prev)
+
+		if !wrapper(prev, child) {
+			return nil
+		}
+
+		prev = child
+	}
+
+	return nil
+}
+
+// namesControl checks if an image is all a link or button holds, so its alt
+// is the name of the link or button.
+func namesControl(n *html.Node) bool {
+	for wrapper(n.Parent, n) || (n.Parent != nil && n.Parent.DataAtom == atom.Button && onlyChild(n.Parent) == n) {
+		n = n.Parent
+
+		if n.DataAtom == atom.A || n.DataAtom == atom.Button {
+			return !labeled(n)
+		}
+	}
+
+	return false
+}
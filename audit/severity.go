@@ -0,0 +1,34 @@
+package audit
+
+// Severity is how much a Finding matters.
+type Severity int
+
+const (
+	// Note findings are worth a look, but may be fine.
+	Note Severity = iota
+	// Warning findings make an image hard to understand.
+	Warning
+	// Error findings leave an image with no text alternative at all.
+	Error
+)
+
+var severityNames = map[Severity]string{
+	Note:    "note",
+	Warning: "warning",
+	Error:   "error",
+}
+
+// ParseSeverity parses a severity name like "warning".
+func ParseSeverity(name string) (Severity, error) {
+	for severity, severityName := range severityNames {
+		if severityName == name {
+			return severity, nil
+		}
+	}
+
+	return Error, &SeverityError{name}
+}
+
+func (s Severity) String() string {
+	return severityNames[s]
+}
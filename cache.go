@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/samuelstevens/gocaption/caption"
+	"github.com/samuelstevens/gocaption/cli"
+	"github.com/samuelstevens/gocaption/util"
+)
+
+// cacheFilter builds a caption.Filter from the cache subcommand's options.
+func cacheFilter(opts *cli.CacheOptions) *caption.Filter {
+	filter := &caption.Filter{Pattern: opts.Pattern, Provider: opts.Provider}
+
+	if opts.OlderThan > 0 {
+		filter.Before = time.Now().Add(-opts.OlderThan)
+	}
+
+	for _, arg := range opts.Args {
+		// an image on disk is looked up by its hash
+		if info, err := os.Stat(arg); err == nil && !info.IsDir() {
+			hash, err := util.HashFile(arg)
+
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+
+			arg = hash
+		}
+
+		filter.Hashes = append(filter.Hashes, arg)
+	}
+
+	return filter
+}
+
+func displayCacheEntry(c *caption.Caption) {
+	hash := c.Hash
+
+	if len(hash) > 10 {
+		hash = hash[:10]
+	}
+
+	created := "-"
+
+	if !c.Created.IsZero() {
+		created = c.Created.Local().Format("2006-01-02")
+	}
+
+	language := c.Language
+
+	if language == "" {
+		language = "-"
+	}
+
+	source := c.Source
+
+	if source == "" {
+		source = c.FilePath
+	}
+
+	fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\n", hash, created, caption.ProviderName(c), language, source, c.Description)
+}
+
+// cacheCommand runs "gocaption cache" and returns the exit status.
+func cacheCommand(opts *cli.CacheOptions) int {
+	cache, err := caption.OpenCache(opts.CacheFile)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	defer func() {
+		if err := cache.Close(); err != nil {
+			log.Fatalf("Couldn't save caption cache: %s.\n", err.Error())
+		}
+	}()
+
+	if opts.Command == "migrate" {
+		return migrateCommand(cache, opts)
+	}
+
+	filter := cacheFilter(opts)
+
+	captions, err := cache.Captions()
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	switch opts.Command {
+	case "list":
+		for _, c := range captions {
+			if filter.Match(c) {
+				displayCacheEntry(c)
+			}
+		}
+
+	case "inspect":
+		if len(opts.Args) == 0 {
+			fmt.Println("Please supply hash(es) or image(s) to inspect.")
+			return 2
+		}
+
+		matches := []*caption.Caption{}
+
+		for _, c := range captions {
+			if filter.Match(c) {
+				matches = append(matches, c)
+			}
+		}
+
+		jsonRep, err := json.MarshalIndent(matches, "", "\t")
+
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		fmt.Println(string(jsonRep))
+
+		if len(matches) == 0 {
+			return 1
+		}
+
+	case "invalidate":
+		if filter.Empty() && !opts.All {
+			fmt.Println("Not invalidating every caption; narrow it down with --pattern, --older-than, --provider or hashes, or use --all.")
+			return 2
+		}
+
+		removed, err := cache.Remove(filter.Match)
+
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		fmt.Printf("Invalidated %d captions.\n", removed)
+
+	case "prune":
+		removed, err := caption.Prune(cache)
+
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		fmt.Printf("Pruned %d captions of images that no longer exist.\n", removed)
+
+	default:
+		fmt.Printf("Unknown cache command %q; use list, inspect, invalidate, prune or migrate.\n", opts.Command)
+		return 2
+	}
+
+	return 0
+}
+
+// migrateCommand copies every caption in cache into the cache file given as
+// the only argument, which can be either kind of cache.
+func migrateCommand(cache caption.Store, opts *cli.CacheOptions) int {
+	if len(opts.Args) != 1 {
+		fmt.Println("Please supply the cache file to migrate to.")
+		return 2
+	}
+
+	to, err := caption.OpenCache(util.ExpandUserDirectory(opts.Args[0]))
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	copied, err := caption.Migrate(cache, to)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	if err := to.Close(); err != nil {
+		log.Fatalf("Couldn't save caption cache: %s.\n", err.Error())
+	}
+
+	fmt.Printf("Migrated %d captions to %s.\n", copied, opts.Args[0])
+
+	return 0
+}
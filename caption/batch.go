@@ -0,0 +1,160 @@
+package caption
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/samuelstevens/gocaption/api"
+)
+
+// Request is an image to caption along with any description it already has.
+type Request struct {
+	Source          Source
+	PrevDescription string
+	// Language is the language to caption the image in; empty is the
+	// describer's default.
+	Language string
+}
+
+// Key identifies an image in a language, like the Source name and Language
+// of a Request.
+func Key(name string, language string) string {
+	if language == "" {
+		return name
+	}
+
+	return name + "@" + strings.ToLower(language)
+}
+
+// Result is the outcome of captioning a single image.
+type Result struct {
+	Caption *Caption
+	Err     error
+}
+
+// NewBatch captions every request using up to jobs concurrent workers.
+// Images that hash to the same contents are only described once per
+// language. Every request keeps its own PrevDescription, so the same image on
+// two pages can get two results. Results are in the order of requests.
+func NewBatch(requests []Request, describer api.Describer, jobs int) []Result {
+	paths := []string{}
+	index := map[string]int{}
+	sources := map[string]Source{}
+	languages := map[string]string{}
+	// described is whether any request for a path has no previous alt, so
+	// the path needs a new description
+	described := map[string]bool{}
+
+	for _, request := range requests {
+		path := Key(request.Source.Name(), request.Language)
+
+		if _, seen := index[path]; !seen {
+			index[path] = len(paths)
+			paths = append(paths, path)
+			sources[path] = request.Source
+			languages[path] = request.Language
+		}
+
+		if request.PrevDescription == "" {
+			described[path] = true
+		}
+	}
+
+	hashes := make([]string, len(paths))
+	hashErrs := make([]error, len(paths))
+
+	// hashing may download remote images, so it is done concurrently too
+	parallel(len(paths), jobs, func(i int) {
+		hashes[i], hashErrs[i] = sources[paths[i]].Hash()
+	})
+
+	// group paths with identical contents and languages so each is only
+	// described once
+	groups := map[string]int{}
+	order := []int{}
+
+	for i, path := range paths {
+		if hashErrs[i] != nil || !described[path] {
+			continue
+		}
+
+		key := Key(hashes[i], languages[path])
+
+		if _, ok := groups[key]; !ok {
+			groups[key] = len(order)
+			order = append(order, i)
+		}
+	}
+
+	groupResults := make([]Result, len(order))
+
+	parallel(len(order), jobs, func(i int) {
+		path := paths[order[i]]
+
+		caption, err := newFromHash(hashes[order[i]], sources[path], "", languages[path], describer)
+		groupResults[i] = Result{caption, err}
+	})
+
+	// images without a caption yet get the previous alt of each request, and
+	// the alt of one request mustn't decide what another gets from the cache
+	cached := make([]bool, len(paths))
+
+	for i, path := range paths {
+		if hashErrs[i] == nil {
+			_, cached[i] = captionCache.Get(hashes[i], languages[path], captionProfile)
+		}
+	}
+
+	results := make([]Result, len(requests))
+
+	for i, request := range requests {
+		j := index[Key(request.Source.Name(), request.Language)]
+
+		switch {
+		case hashErrs[j] != nil:
+			results[i] = Result{&Caption{Description: request.PrevDescription}, hashErrs[j]}
+		case request.PrevDescription != "" && cached[j]:
+			caption, err := newFromHash(hashes[j], request.Source, request.PrevDescription, request.Language, describer)
+			results[i] = Result{caption, err}
+		case request.PrevDescription != "":
+			// a previous alt is kept as is, which is quick
+			caption, err := newUncached(hashes[j], request.Source, request.PrevDescription, request.Language, describer)
+			results[i] = Result{caption, err}
+		default:
+			results[i] = groupResults[groups[Key(hashes[j], request.Language)]]
+		}
+	}
+
+	return results
+}
+
+// parallel calls work for every index in [0, count) using up to jobs goroutines.
+func parallel(count int, jobs int, work func(i int)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	indices := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for j := 0; j < jobs; j++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indices {
+				work(i)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		indices <- i
+	}
+
+	close(indices)
+
+	wg.Wait()
+}
@@ -0,0 +1,120 @@
+package caption
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samuelstevens/gocaption/api"
+)
+
+func TestNewBatch(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	describer := &fakeDescriber{candidates: []api.Candidate{{Text: "a cat", Confidence: 0.9}}}
+
+	requests := []Request{
+		{Source: File(writeImage(t, dir, "a.png", "cat"))},
+		{Source: File(writeImage(t, dir, "b.png", "cat"))},
+		{Source: File(writeImage(t, dir, "c.png", "dog")), PrevDescription: "my dog"},
+		{Source: File(writeImage(t, dir, "a.png", "cat"))},
+		{Source: File(filepath.Join(dir, "missing.png"))},
+	}
+
+	results := NewBatch(requests, describer, 3)
+
+	if len(results) != len(requests) {
+		t.Fatalf("got %d results, want %d", len(results), len(requests))
+	}
+
+	if describer.calls != 1 {
+		t.Errorf("describer called %d times, want 1", describer.calls)
+	}
+
+	cases := []struct {
+		path string
+		want string
+		err  bool
+	}{
+		{path: "a.png", want: "a cat"},
+		{path: "b.png", want: "a cat"},
+		{path: "c.png", want: "my dog"},
+		{path: "a.png", want: "a cat"},
+		{path: "missing.png", err: true},
+	}
+
+	for i, c := range cases {
+		result := results[i]
+
+		if c.err {
+			if result.Err == nil {
+				t.Errorf("%s: wanted an error", c.path)
+			}
+			continue
+		}
+
+		if result.Err != nil {
+			t.Errorf("%s: got error %s; wanted no error", c.path, result.Err.Error())
+			continue
+		}
+
+		if result.Caption.Description != c.want {
+			t.Errorf("%s: got %s, want %s", c.path, result.Caption.Description, c.want)
+		}
+	}
+}
+
+func TestNewBatchLanguages(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	describer := &fakeDescriber{candidates: []api.Candidate{{Text: "a cat", Confidence: 0.9}}}
+	imgPath := writeImage(t, dir, "a.png", "cat")
+
+	requests := []Request{
+		{Source: File(imgPath)},
+		{Source: File(imgPath), Language: "es"},
+		{Source: File(writeImage(t, dir, "b.png", "cat")), Language: "es"},
+	}
+
+	results := NewBatch(requests, describer, 2)
+
+	if describer.calls != 2 {
+		t.Errorf("describer called %d times, want 2", describer.calls)
+	}
+
+	for i, result := range results {
+		if result.Err != nil || result.Caption == nil {
+			t.Errorf("missing result for request %d", i)
+		}
+	}
+}
+
+func TestNewBatchPrevDescriptions(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	describer := &fakeDescriber{candidates: []api.Candidate{{Text: "a cat", Confidence: 0.9}}}
+	imgPath := writeImage(t, dir, "a.png", "cat")
+
+	// the same images on several pages, with different alts
+	requests := []Request{
+		{Source: File(imgPath), PrevDescription: "Whiskers"},
+		{Source: File(imgPath), PrevDescription: "my cat"},
+		{Source: File(writeImage(t, dir, "b.png", "dog")), PrevDescription: "Rex"},
+		{Source: File(filepath.Join(dir, "b.png"))},
+	}
+
+	results := NewBatch(requests, describer, 2)
+
+	for i, want := range []string{"Whiskers", "my cat", "a cat", "a cat"} {
+		if results[i].Err != nil || results[i].Caption.Description != want {
+			t.Errorf("request %d got %+v, want %s", i, results[i].Caption, want)
+		}
+	}
+
+	if describer.calls != 1 {
+		t.Errorf("describer called %d times, want 1", describer.calls)
+	}
+}
@@ -1,148 +1,231 @@
 package caption
 
 import (
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
-	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/samuelstevens/gocaption/api"
-	"github.com/samuelstevens/gocaption/util"
 )
 
+// The Status of a caption that needs or has had a human's review. Captions
+// that were confident enough to use have no Status.
 const (
-	captionFileDir  = "."
-	captionFileName = "captions.json"
+	// Pending captions weren't confident enough to put in a page, and wait
+	// for review with "gocaption review".
+	Pending = "pending"
+	// Verified captions were accepted or written by a human. They are never
+	// made again, whatever the Profile.
+	Verified = "verified"
+	// Rejected captions were turned down by a human, so their images keep
+	// the alt they have.
+	Rejected = "rejected"
 )
 
-// Caption is a caption and confidence for a file
+// Where a caption came from in this run.
+const (
+	// FromCache captions were found in the cache.
+	FromCache = "cache"
+	// FromAPI captions were made by the describer.
+	FromAPI = "api"
+	// FromExisting captions are the description an image already had.
+	FromExisting = "existing"
+)
+
+// Caption is a caption and confidence for a file, along with how it was made.
 type Caption struct {
-	hash        string
+	Hash        string
 	FilePath    string
 	Description string
 	Confidence  float64
+	// Candidates are every caption the describer suggested, most confident first.
+	Candidates []api.Candidate `json:",omitempty"`
+	// Details are what else the describer found, if it was asked to.
+	Details *api.Details `json:",omitempty"`
+	// Source is the path or URL of the image that was captioned.
+	Source   string `json:",omitempty"`
+	Language string `json:",omitempty"`
+	// Provider, Model and Options are the Profile of the caption. They are
+	// empty for captions cached before they were recorded.
+	Provider string            `json:",omitempty"`
+	Model    string            `json:",omitempty"`
+	Options  map[string]string `json:",omitempty"`
+	// LowConfidence is the LowConfidencePolicy, like "queue", of a caption
+	// less confident than the threshold. It is empty for confident captions.
+	LowConfidence string `json:",omitempty"`
+	// Status is Pending, Verified or Rejected for captions that need or
+	// have had review.
+	Status  string `json:",omitempty"`
+	Created time.Time
+	// Origin is where the caption came from in this run, like FromCache. It
+	// isn't cached.
+	Origin string `json:"-"`
 }
 
-type captions struct {
-	lookup   map[string]*Caption
-	filepath string
-}
-
-var captionCache *captions
-
-// New returns a new caption for an image.
-func New(imgPath string, prevDescription string, client *api.Client) (*Caption, error) {
+// New returns a new caption for an image in a language like "es", or the
+// describer's default language if it is empty.
+func New(source Source, prevDescription string, language string, describer api.Describer) (*Caption, error) {
 
 	defaultCaption := Caption{Description: prevDescription}
 
-	hash, err := util.HashFile(imgPath)
+	hash, err := source.Hash()
 
 	if err != nil {
 		return &defaultCaption, err
 	}
 
-	caption, ok := captionCache.get(hash)
+	return newFromHash(hash, source, prevDescription, language, describer)
+}
+
+// newFromHash is New for an image that has already been hashed.
+func newFromHash(hash string, source Source, prevDescription string, language string, describer api.Describer) (*Caption, error) {
+
+	defaultCaption := Caption{Description: prevDescription}
+
+	caption, ok := captionCache.Get(hash, language, captionProfile)
 
 	if ok {
-		return caption, nil
+		hit := *caption
+		hit.Origin = FromCache
+
+		caption, err := applyLowConfidence(&hit)
+
+		if err != nil {
+			return &defaultCaption, err
+		}
+
+		return caption.published(prevDescription)
 	}
 
+	return newUncached(hash, source, prevDescription, language, describer)
+}
+
+// newUncached is newFromHash without looking in the cache first.
+func newUncached(hash string, source Source, prevDescription string, language string, describer api.Describer) (*Caption, error) {
+
+	defaultCaption := Caption{Description: prevDescription}
+
 	description := prevDescription
+	origin := FromExisting
+	lowConfidencePolicy := ""
+	status := ""
 	confidence := 1.0
+	candidates := []api.Candidate(nil)
+	details := (*api.Details)(nil)
 
 	if description == "" {
 		confidence = 0.0
+		origin = FromAPI
+
+		result, err := describe(source, language, describer)
+
+		if _, ok := err.(*api.ConfidenceError); err != nil && !ok {
+			return &defaultCaption, err // only if not a confidence error
+		}
+
+		best, _ := result.Best()
 
-		imageCaption, err := client.Describe(imgPath)
+		text, templateErr := render(result)
+
+		if templateErr != nil {
+			return &defaultCaption, templateErr
+		}
+
+		description = text
 
 		if err != nil {
-			if _, ok := err.(*api.ConfidenceError); ok {
-				description = fmt.Sprintf("Possibly inaccurate: %s", *imageCaption.Text)
-			} else {
-				return &defaultCaption, err // only if not a confidence error
-			}
+			// the policy decides the alt each time the caption is published
+			lowConfidencePolicy = lowConfidence.String()
 
-		} else {
-			description = *imageCaption.Text
+			if lowConfidence == Queue {
+				status = Pending
+			}
 		}
 
-		confidence = *imageCaption.Confidence
+		confidence = best.Confidence
+		candidates = result.Candidates
+
+		if !result.Details.Empty() {
+			details = &result.Details
+		}
 	}
 
 	c := Caption{
-		hash:        hash,
-		FilePath:    filepath.Base(imgPath),
-		Description: description,
-		Confidence:  confidence,
+		Hash:          hash,
+		FilePath:      baseName(source),
+		Description:   description,
+		Confidence:    confidence,
+		Candidates:    candidates,
+		Details:       details,
+		Source:        source.Name(),
+		Language:      strings.ToLower(language),
+		Provider:      captionProfile.Provider,
+		Model:         captionProfile.Model,
+		Options:       captionProfile.Options,
+		LowConfidence: lowConfidencePolicy,
+		Status:        status,
+		Created:       time.Now(),
+		Origin:        origin,
 	}
 
-	return &c, captionCache.set(&c)
-}
-
-func (c *captions) save() error {
-	jsonRep, err := json.MarshalIndent(c.lookup, "", "\t")
+	cacheErr := captionCache.Set(&c)
+	published, err := c.published(prevDescription)
 
 	if err != nil {
-		return err
+		return &defaultCaption, err
 	}
 
-	err = ioutil.WriteFile(c.filepath, jsonRep, 0666)
+	return published, cacheErr
+}
 
-	if err != nil {
-		fmt.Println("Saving error")
-		return err
+// published is the caption to put in a page. Low-confidence captions get the
+// alt their LowConfidencePolicy decides on, unless they have been reviewed.
+// Captions that shouldn't be put in a page keep prevDescription.
+func (c *Caption) published(prevDescription string) (*Caption, error) {
+	if c.Status == Verified || (c.LowConfidence == "" && c.Status != Pending && c.Status != Rejected) {
+		return c, nil
 	}
 
-	return nil
+	alt := ""
 
-}
+	if c.Status != Rejected {
+		var err error
 
-func InitializeCache(cacheFilepath string) {
-	if captionCache != nil {
-		return
+		if alt, err = lowConfidenceAlt(c); err != nil {
+			return c, err
+		}
 	}
 
-	captionCache = &captions{filepath: cacheFilepath}
-
-	captionCache.lookup = loadLookup(captionCache.filepath)
-}
+	if alt == "" {
+		alt = prevDescription
+	}
 
-func loadLookup(filepath string) map[string]*Caption {
-	defaultMap := map[string]*Caption{}
+	published := *c
+	published.Description = alt
 
-	var res map[string]*Caption
+	return &published, nil
+}
 
-	jsonRep, err := ioutil.ReadFile(filepath)
+// describe describes an image, making sure there is at least one candidate.
+// Like api.Describer, it returns the description along with any
+// *api.ConfidenceError.
+func describe(source Source, language string, describer api.Describer) (*api.Description, error) {
+	image, err := source.Open()
 
 	if err != nil {
-		return defaultMap
+		return nil, err
 	}
 
-	if len(jsonRep) == 0 {
-		return defaultMap
-	}
+	defer image.Close()
 
-	err = json.Unmarshal(jsonRep, &res)
+	description, describeErr := describer.Describe(source.Name(), image, language)
 
-	if err != nil {
-		return defaultMap
+	if _, ok := describeErr.(*api.ConfidenceError); describeErr != nil && !ok {
+		return nil, describeErr
 	}
 
-	return res
-}
-
-func (c *captions) set(caption *Caption) error {
-	if caption.Description == "" {
-		return nil
+	if _, err := description.Best(); err != nil {
+		return nil, err
 	}
 
-	c.lookup[caption.hash] = caption
-
-	return c.save()
-}
-
-func (c *captions) get(hash string) (*Caption, bool) {
-	caption, ok := c.lookup[hash]
-
-	return caption, ok
+	return description, describeErr
 }
@@ -0,0 +1,187 @@
+package caption
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/samuelstevens/gocaption/api"
+)
+
+type fakeDescriber struct {
+	candidates []api.Candidate
+	details    api.Details
+	err        error
+	calls      int
+	languages  []string
+	mu         sync.Mutex
+}
+
+func (d *fakeDescriber) Describe(name string, image io.Reader, language string) (*api.Description, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.calls++
+	d.languages = append(d.languages, language)
+
+	return &api.Description{Candidates: d.candidates, Details: d.details}, d.err
+}
+
+func setupCache(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "caption")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	CloseCache()
+	captionCache = nil
+
+	if err := InitializeCache(filepath.Join(dir, "captions.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func writeImage(t *testing.T, dir string, name string, contents string) string {
+	path := filepath.Join(dir, name)
+
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		prev       string
+		candidates []api.Candidate
+		err        error
+		want       string
+		calls      int
+	}{
+		{
+			candidates: []api.Candidate{{Text: "a cat", Confidence: 0.9}},
+			want:       "a cat",
+			calls:      1,
+		},
+		{
+			candidates: []api.Candidate{{Text: "a dog", Confidence: 0.2}},
+			err:        &api.ConfidenceError{Confidence: 0.2},
+			want:       "",
+			calls:      1,
+		},
+		{
+			prev:  "my own words",
+			want:  "my own words",
+			calls: 0,
+		},
+	}
+
+	for i, c := range cases {
+		dir := setupCache(t)
+		defer os.RemoveAll(dir)
+
+		describer := &fakeDescriber{candidates: c.candidates, err: c.err}
+		imgPath := writeImage(t, dir, "image.png", string(rune('a'+i)))
+
+		got, err := New(File(imgPath), c.prev, "", describer)
+
+		if err != nil {
+			t.Errorf("got error %s; wanted no error", err.Error())
+			continue
+		}
+
+		if got.Description != c.want {
+			t.Errorf("New(%s).Description == %s, want %s", imgPath, got.Description, c.want)
+		}
+
+		if describer.calls != c.calls {
+			t.Errorf("describer called %d times, want %d", describer.calls, c.calls)
+		}
+	}
+}
+
+func TestNewUsesCache(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	describer := &fakeDescriber{candidates: []api.Candidate{{Text: "a cat", Confidence: 0.9}}}
+
+	first := writeImage(t, dir, "first.png", "same bytes")
+	second := writeImage(t, dir, "second.png", "same bytes")
+
+	for _, path := range []string{first, second} {
+		if _, err := New(File(path), "", "", describer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if describer.calls != 1 {
+		t.Errorf("describer called %d times, want 1", describer.calls)
+	}
+}
+
+func TestNewCachesEachLanguage(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	describer := &fakeDescriber{candidates: []api.Candidate{{Text: "un gato", Confidence: 0.9}}}
+	imgPath := writeImage(t, dir, "cat.png", "cat")
+
+	for _, language := range []string{"", "es", "ES", "ja"} {
+		if _, err := New(File(imgPath), "", language, describer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"", "es", "ja"}
+
+	if len(describer.languages) != len(want) {
+		t.Fatalf("described in %v, want %v", describer.languages, want)
+	}
+
+	for i := range want {
+		if describer.languages[i] != want[i] {
+			t.Errorf("described in %v, want %v", describer.languages, want)
+		}
+	}
+}
+
+func TestNewRecordsProvenance(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+	defer SetProfile(Profile{})
+
+	profile := Profile{Provider: "azure", Model: "v2", Options: map[string]string{"threshold": "0.5"}}
+	SetProfile(profile)
+
+	describer := &fakeDescriber{candidates: []api.Candidate{{Text: "un gato", Confidence: 0.9}}}
+	imgPath := writeImage(t, dir, "cat.png", "cat")
+
+	got, err := New(File(imgPath), "", "ES", describer)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Source != imgPath || got.Language != "es" || got.Provider != "azure" || got.Model != "v2" || got.Created.IsZero() {
+		t.Errorf("New() didn't record where the caption came from: %+v", got)
+	}
+
+	// a different threshold makes a new caption
+	SetProfile(Profile{Provider: "azure", Model: "v2", Options: map[string]string{"threshold": "0.7"}})
+
+	if _, err := New(File(imgPath), "", "es", describer); err != nil {
+		t.Fatal(err)
+	}
+
+	if describer.calls != 2 {
+		t.Errorf("describer called %d times, want 2", describer.calls)
+	}
+}
@@ -0,0 +1,61 @@
+package caption
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CorruptCacheError occurs when a cache file exists but can't be parsed.
+type CorruptCacheError struct {
+	Path string
+	Err  error
+}
+
+func (e *CorruptCacheError) Error() string {
+	return fmt.Sprintf("cache %s is unreadable (%s); move or delete it to start a new cache", e.Path, e.Err.Error())
+}
+
+func (e *CorruptCacheError) Unwrap() error {
+	return e.Err
+}
+
+// ErrCacheClosed occurs when adding a caption to a closed Cache.
+var ErrCacheClosed = errors.New("cache is closed")
+
+// DataURIError occurs when a data URI can't be decoded.
+type DataURIError struct {
+	reason string
+}
+
+func (e *DataURIError) Error() string {
+	return fmt.Sprintf("bad data URI: %s", e.reason)
+}
+
+// FetchError occurs when a remote image can't or shouldn't be downloaded.
+type FetchError struct {
+	URL    string
+	Reason string
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("can't fetch %s: %s", e.URL, e.Reason)
+}
+
+// ResolveError occurs when an image reference can't be resolved to a Source.
+type ResolveError struct {
+	Ref    string
+	Reason string
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("can't resolve %s: %s", e.Ref, e.Reason)
+}
+
+// LowConfidenceError occurs when a low-confidence policy name isn't known.
+type LowConfidenceError struct {
+	name string
+}
+
+func (e *LowConfidenceError) Error() string {
+	return fmt.Sprintf("%q is not a low-confidence policy (prefix, skip, placeholder or queue)", e.name)
+}
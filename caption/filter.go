@@ -0,0 +1,77 @@
+package caption
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Filter matches cached captions. An empty Filter matches every caption.
+type Filter struct {
+	// Pattern is a glob matched against the image's path or URL and against
+	// its base name. A Pattern ending in "/" matches everything under it.
+	Pattern string
+	// Before matches captions created before it.
+	Before time.Time
+	// Provider matches captions by provider; "unknown" matches captions
+	// cached before providers were recorded.
+	Provider string
+	// Hashes matches captions whose hash starts with any of them.
+	Hashes []string
+}
+
+// Empty checks if a Filter matches every caption.
+func (f *Filter) Empty() bool {
+	return f.Pattern == "" && f.Before.IsZero() && f.Provider == "" && len(f.Hashes) == 0
+}
+
+// Match checks if a caption matches every part of the Filter.
+func (f *Filter) Match(caption *Caption) bool {
+	if f.Pattern != "" && !f.matchPattern(caption) {
+		return false
+	}
+
+	if !f.Before.IsZero() && !caption.Created.Before(f.Before) {
+		return false
+	}
+
+	if f.Provider != "" && !strings.EqualFold(f.Provider, ProviderName(caption)) {
+		return false
+	}
+
+	if len(f.Hashes) > 0 {
+		for _, hash := range f.Hashes {
+			if hash != "" && strings.HasPrefix(caption.Hash, hash) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func (f *Filter) matchPattern(caption *Caption) bool {
+	if strings.HasSuffix(f.Pattern, "/") {
+		return strings.HasPrefix(filepath.ToSlash(caption.Source), filepath.ToSlash(f.Pattern))
+	}
+
+	for _, name := range []string{caption.Source, caption.FilePath} {
+		if ok, _ := filepath.Match(f.Pattern, name); ok && name != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ProviderName is the provider of a caption, or "unknown" for captions cached
+// before providers were recorded.
+func ProviderName(caption *Caption) string {
+	if caption.Provider == "" {
+		return "unknown"
+	}
+
+	return caption.Provider
+}
@@ -0,0 +1,48 @@
+package caption
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	now := time.Now()
+
+	cat := &Caption{
+		Hash:     "nZiejSfcng7D",
+		FilePath: "cat.png",
+		Source:   "/site/blog/cat.png",
+		Provider: "azure",
+		Created:  now.Add(-48 * time.Hour),
+	}
+	legacy := &Caption{Hash: "Q2F0", FilePath: "dog.png"}
+
+	cases := []struct {
+		filter Filter
+		cat    bool
+		legacy bool
+	}{
+		{Filter{}, true, true},
+		{Filter{Pattern: "*.png"}, true, true},
+		{Filter{Pattern: "/site/blog/*"}, true, false},
+		{Filter{Pattern: "/site/"}, true, false},
+		{Filter{Pattern: "dog*"}, false, true},
+		{Filter{Provider: "Azure"}, true, false},
+		{Filter{Provider: "unknown"}, false, true},
+		{Filter{Before: now.Add(-24 * time.Hour)}, true, true},
+		{Filter{Before: now.Add(-72 * time.Hour)}, false, true},
+		{Filter{Hashes: []string{"nZie"}}, true, false},
+		{Filter{Hashes: []string{"nzie"}}, false, false},
+		{Filter{Hashes: []string{"x", "Q2"}, Pattern: "*.png"}, false, true},
+	}
+
+	for _, c := range cases {
+		if got := c.filter.Match(cat); got != c.cat {
+			t.Errorf("%+v matches cat: %v, want %v", c.filter, got, c.cat)
+		}
+
+		if got := c.filter.Match(legacy); got != c.legacy {
+			t.Errorf("%+v matches legacy: %v, want %v", c.filter, got, c.legacy)
+		}
+	}
+}
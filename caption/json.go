@@ -0,0 +1,262 @@
+package caption
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuelstevens/gocaption/util"
+)
+
+const (
+	// flushEvery is how many new captions a JSONStore holds before writing to
+	// disk.
+	flushEvery = 20
+	// flushInterval is the longest a new caption waits before being written to disk.
+	flushInterval = 5 * time.Second
+)
+
+// JSONStore is a thread-safe map from image hashes to captions that is saved
+// as a json file. It is loaded into memory, and rewritten in full whenever new
+// captions are written.
+type JSONStore struct {
+	lookup   map[string]*Caption
+	filepath string
+
+	mu      sync.Mutex
+	pending int
+	timer   *time.Timer
+	err     error
+	closed  bool
+}
+
+// OpenJSONStore loads a JSONStore from a json file. A missing or empty file is
+// an empty JSONStore. A file that can't be parsed returns a
+// *CorruptCacheError rather than an empty JSONStore, so that it is never
+// overwritten.
+func OpenJSONStore(cacheFilepath string) (*JSONStore, error) {
+	lookup, err := loadLookup(cacheFilepath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &JSONStore{lookup: lookup, filepath: cacheFilepath}, nil
+}
+
+func loadLookup(cacheFilepath string) (map[string]*Caption, error) {
+	lookup := map[string]*Caption{}
+
+	jsonRep, err := ioutil.ReadFile(cacheFilepath)
+
+	if os.IsNotExist(err) {
+		return lookup, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(jsonRep) == 0 {
+		return lookup, nil
+	}
+
+	err = json.Unmarshal(jsonRep, &lookup)
+
+	if err != nil {
+		return nil, &CorruptCacheError{cacheFilepath, err}
+	}
+
+	return rekey(lookup), nil
+}
+
+// rekey keys every caption by its key, filling in the hash and language of
+// captions cached before they were recorded from their old "hash" or
+// "hash@language" keys.
+func rekey(lookup map[string]*Caption) map[string]*Caption {
+	keyed := make(map[string]*Caption, len(lookup))
+
+	for key, caption := range lookup {
+		if caption == nil {
+			continue
+		}
+
+		if caption.Hash == "" {
+			parts := strings.SplitN(key, "@", 2)
+			caption.Hash = parts[0]
+
+			if len(parts) == 2 {
+				caption.Language = parts[1]
+			}
+		}
+
+		keyed[caption.key()] = caption
+	}
+
+	return keyed
+}
+
+// Get looks up a caption by its image hash, language and Profile.
+func (c *JSONStore) Get(hash string, language string, profile Profile) (*Caption, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range lookupKeys(hash, language, profile) {
+		if caption, ok := c.lookup[key]; ok {
+			return caption, true
+		}
+	}
+
+	return nil, false
+}
+
+// Set adds a caption to the JSONStore. The JSONStore is written to disk once
+// enough captions are pending or after a short delay, whichever comes first.
+func (c *JSONStore) Set(caption *Caption) error {
+	if caption.Description == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrCacheClosed
+	}
+
+	c.lookup[caption.key()] = caption
+	c.pending++
+
+	if c.pending >= flushEvery {
+		return c.flush()
+	}
+
+	if c.timer == nil {
+		c.timer = time.AfterFunc(flushInterval, c.delayedFlush)
+	}
+
+	// report any error from a delayed flush
+	err := c.err
+	c.err = nil
+
+	return err
+}
+
+// Captions lists every caption in the JSONStore, oldest first.
+func (c *JSONStore) Captions() ([]*Caption, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	captions := make([]*Caption, 0, len(c.lookup))
+
+	for _, caption := range c.lookup {
+		captions = append(captions, caption)
+	}
+
+	sort.Slice(captions, func(i, j int) bool {
+		if !captions[i].Created.Equal(captions[j].Created) {
+			return captions[i].Created.Before(captions[j].Created)
+		}
+
+		return captions[i].key() < captions[j].key()
+	})
+
+	return captions, nil
+}
+
+// Remove deletes every caption that matches and writes the JSONStore to disk.
+// It returns how many captions were removed.
+func (c *JSONStore) Remove(match func(caption *Caption) bool) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return 0, ErrCacheClosed
+	}
+
+	removed := 0
+
+	for key, caption := range c.lookup {
+		if match(caption) {
+			delete(c.lookup, key)
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	c.pending += removed
+
+	return removed, c.flush()
+}
+
+// Flush writes any pending captions to disk.
+func (c *JSONStore) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.flush()
+}
+
+// Close flushes the JSONStore. Captions can't be added after a JSONStore is
+// closed.
+func (c *JSONStore) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+
+	c.closed = true
+
+	if err := c.flush(); err != nil {
+		return err
+	}
+
+	return c.err
+}
+
+// delayedFlush flushes from a timer, keeping any error to report later.
+func (c *JSONStore) delayedFlush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.flush(); err != nil {
+		c.err = err
+	}
+}
+
+// flush must be called while holding c.mu.
+func (c *JSONStore) flush() error {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+
+	if c.pending == 0 {
+		return nil
+	}
+
+	jsonRep, err := json.MarshalIndent(c.lookup, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	err = util.WriteFileAtomic(c.filepath, jsonRep, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	c.pending = 0
+
+	return nil
+}
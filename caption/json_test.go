@@ -0,0 +1,175 @@
+package caption
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestJSONStoreRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "captions.json")
+
+	cache, err := OpenJSONStore(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 3*flushEvery; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			cache.Set(&Caption{Hash: string(rune('A' + i)), Description: "a cat"})
+		}(i)
+	}
+
+	wg.Wait()
+
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cache.Set(&Caption{Hash: "late", Description: "a dog"}); err != ErrCacheClosed {
+		t.Errorf("got error %v; wanted %v", err, ErrCacheClosed)
+	}
+
+	reopened, err := OpenJSONStore(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reopened.lookup) != 3*flushEvery {
+		t.Errorf("reopened cache has %d captions, want %d", len(reopened.lookup), 3*flushEvery)
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tmp*"))
+
+	if len(leftovers) != 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestOpenCorruptJSONStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		contents string
+		corrupt  bool
+	}{
+		{contents: "", corrupt: false},
+		{contents: "null", corrupt: false},
+		{contents: "{}", corrupt: false},
+		{contents: "{\"abc\": {\"Description\": \"a c", corrupt: true},
+	}
+
+	for _, c := range cases {
+		path := filepath.Join(dir, "captions.json")
+
+		if err := ioutil.WriteFile(path, []byte(c.contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cache, err := OpenJSONStore(path)
+
+		if c.corrupt {
+			if _, ok := err.(*CorruptCacheError); !ok {
+				t.Errorf("OpenJSONStore(%q): got error %v; wanted a *CorruptCacheError", c.contents, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("OpenJSONStore(%q): got error %s; wanted no error", c.contents, err.Error())
+			continue
+		}
+
+		if cache.lookup == nil {
+			t.Errorf("OpenJSONStore(%q) has a nil lookup", c.contents)
+		}
+	}
+}
+
+func TestJSONStoreProfiles(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+	defer SetProfile(Profile{})
+
+	path := filepath.Join(dir, "legacy.json")
+	legacy := `{"abc": {"FilePath": "cat.png", "Description": "a cat"}, "abc@es": {"FilePath": "cat.png", "Description": "un gato"}}`
+
+	if err := ioutil.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := OpenJSONStore(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	azure := Profile{Provider: "azure", Model: "v2", Options: map[string]string{"threshold": "0.5"}}
+	templated := Profile{Provider: "azure", Model: "v2", Options: map[string]string{"threshold": "0.5", "template": "{{.Caption}}"}}
+
+	if c, ok := cache.Get("abc", "es", azure); !ok || c.Description != "un gato" {
+		t.Errorf("legacy captions should be reused by Azure with default options")
+	}
+
+	if _, ok := cache.Get("abc", "", templated); ok {
+		t.Errorf("legacy captions shouldn't be reused with a template")
+	}
+
+	cache.Set(&Caption{Hash: "abc", Description: "a templated cat", Provider: "azure", Model: "v2", Options: templated.Options})
+
+	if c, ok := cache.Get("abc", "", templated); !ok || c.Description != "a templated cat" {
+		t.Errorf("got %+v, want the templated caption", c)
+	}
+
+	if c, ok := cache.Get("abc", "", azure); !ok || c.Description != "a cat" {
+		t.Errorf("got %+v, want the legacy caption", c)
+	}
+
+	other := Profile{Provider: "azure", Model: "v3", Options: map[string]string{"threshold": "0.5"}}
+
+	if _, ok := cache.Get("abc", "", other); !ok {
+		t.Errorf("legacy captions should be reused by any Azure model")
+	}
+
+	if _, ok := cache.Get("abc", "", Profile{Provider: "ollama"}); ok {
+		t.Errorf("legacy captions shouldn't be reused by other providers")
+	}
+
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenJSONStore(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, ok := reopened.Get("abc", "", templated); !ok || c.Hash != "abc" {
+		t.Errorf("captions should keep their hash and profile on disk, got %+v", c)
+	}
+}
@@ -0,0 +1,139 @@
+package caption
+
+import (
+	"strings"
+	"text/template"
+)
+
+// LowConfidencePolicy decides what goes in the alt of an image whose caption
+// is less confident than the threshold.
+type LowConfidencePolicy int
+
+const (
+	// Queue leaves the alt alone until the caption is approved with
+	// "gocaption review".
+	Queue LowConfidencePolicy = iota
+	// Prefix uses the caption after a prefix like "Possibly inaccurate: ".
+	Prefix
+	// Skip leaves the alt alone.
+	Skip
+	// Placeholder uses a placeholder like "Image" instead of the caption.
+	Placeholder
+)
+
+var lowConfidenceNames = map[LowConfidencePolicy]string{
+	Queue:       "queue",
+	Prefix:      "prefix",
+	Skip:        "skip",
+	Placeholder: "placeholder",
+}
+
+const (
+	// DefaultPrefix comes before low-confidence captions with the Prefix
+	// policy.
+	DefaultPrefix = "Possibly inaccurate: "
+	// DefaultPlaceholder is the alt of low-confidence images with the
+	// Placeholder policy.
+	DefaultPlaceholder = "Image"
+)
+
+// ParseLowConfidence parses a policy name like "queue".
+func ParseLowConfidence(name string) (LowConfidencePolicy, error) {
+	for policy, policyName := range lowConfidenceNames {
+		if policyName == name {
+			return policy, nil
+		}
+	}
+
+	return Queue, &LowConfidenceError{name}
+}
+
+func (p LowConfidencePolicy) String() string {
+	return lowConfidenceNames[p]
+}
+
+var (
+	lowConfidence       = Queue
+	prefixTemplate      = template.Must(template.New("prefix").Parse(DefaultPrefix))
+	placeholderTemplate = template.Must(template.New("placeholder").Parse(DefaultPlaceholder))
+)
+
+// SetLowConfidence sets what New does with low-confidence captions. prefix
+// and placeholder are text/templates of a TemplateData, like
+// "Maybe ({{.Confidence}}): "; empty ones use DefaultPrefix and
+// DefaultPlaceholder.
+func SetLowConfidence(policy LowConfidencePolicy, prefix string, placeholder string) error {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+
+	if placeholder == "" {
+		placeholder = DefaultPlaceholder
+	}
+
+	prefixTmpl, err := template.New("prefix").Funcs(templateFuncs).Parse(prefix)
+
+	if err != nil {
+		return err
+	}
+
+	placeholderTmpl, err := template.New("placeholder").Funcs(templateFuncs).Parse(placeholder)
+
+	if err != nil {
+		return err
+	}
+
+	lowConfidence = policy
+	prefixTemplate = prefixTmpl
+	placeholderTemplate = placeholderTmpl
+
+	return nil
+}
+
+// applyLowConfidence records the current low-confidence policy in a
+// low-confidence caption, so a cached caption follows the policy of the run
+// that uses it. Captions that have been reviewed are left alone.
+func applyLowConfidence(c *Caption) (*Caption, error) {
+	if c.LowConfidence == "" || c.LowConfidence == lowConfidence.String() || c.Status == Verified || c.Status == Rejected {
+		return c, nil
+	}
+
+	updated := *c
+	updated.LowConfidence = lowConfidence.String()
+	updated.Status = ""
+
+	if lowConfidence == Queue {
+		updated.Status = Pending
+	}
+
+	return &updated, captionCache.Set(&updated)
+}
+
+// lowConfidenceAlt builds the alt of a low-confidence caption for its
+// policy. It is empty if the image should keep the alt it has.
+func lowConfidenceAlt(c *Caption) (string, error) {
+	policy, _ := ParseLowConfidence(c.LowConfidence)
+
+	var tmpl *template.Template
+
+	switch policy {
+	case Prefix:
+		tmpl = prefixTemplate
+	case Placeholder:
+		tmpl = placeholderTemplate
+	default:
+		return "", nil
+	}
+
+	var builder strings.Builder
+
+	if err := tmpl.Execute(&builder, c.templateData()); err != nil {
+		return "", err
+	}
+
+	if policy == Prefix {
+		builder.WriteString(" " + c.Description)
+	}
+
+	return strings.Join(strings.Fields(builder.String()), " "), nil
+}
@@ -0,0 +1,78 @@
+package caption
+
+import (
+	"os"
+	"testing"
+
+	"github.com/samuelstevens/gocaption/api"
+)
+
+func TestParseLowConfidence(t *testing.T) {
+	for policy, name := range lowConfidenceNames {
+		if got, err := ParseLowConfidence(name); err != nil || got != policy {
+			t.Errorf("ParseLowConfidence(%q) == %v, %v; want %v", name, got, err, policy)
+		}
+	}
+
+	if _, err := ParseLowConfidence("maybe"); err == nil {
+		t.Errorf("ParseLowConfidence(\"maybe\") should fail")
+	}
+}
+
+func TestLowConfidencePolicies(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+	defer SetLowConfidence(Queue, "", "")
+
+	describer := &fakeDescriber{
+		candidates: []api.Candidate{{Text: "a dog", Confidence: 0.25}},
+		err:        &api.ConfidenceError{Confidence: 0.25},
+	}
+	imgPath := writeImage(t, dir, "cat.png", "cat")
+
+	cases := []struct {
+		policy      LowConfidencePolicy
+		prefix      string
+		placeholder string
+		want        string
+		status      string
+	}{
+		{policy: Prefix, want: "Possibly inaccurate: a dog"},
+		{policy: Prefix, prefix: "Maybe ({{.Confidence}}):", want: "Maybe (0.25): a dog"},
+		{policy: Skip, want: ""},
+		{policy: Placeholder, want: "Image"},
+		{policy: Placeholder, placeholder: "Image of {{.Caption}}?", want: "Image of a dog?"},
+		{policy: Queue, want: "", status: Pending},
+		{policy: Prefix, want: "Possibly inaccurate: a dog"},
+	}
+
+	for _, c := range cases {
+		if err := SetLowConfidence(c.policy, c.prefix, c.placeholder); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := New(File(imgPath), "", "", describer)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Description != c.want || got.Status != c.status {
+			t.Errorf("%s: got %q with status %q, want %q with status %q", c.policy, got.Description, got.Status, c.want, c.status)
+		}
+
+		cached, _ := captionCache.Get(got.Hash, "", captionProfile)
+
+		if cached.LowConfidence != c.policy.String() || cached.Description != "a dog" {
+			t.Errorf("%s: cached %q with policy %q, want the caption with the policy", c.policy, cached.Description, cached.LowConfidence)
+		}
+	}
+
+	if describer.calls != 1 {
+		t.Errorf("describer called %d times, want 1", describer.calls)
+	}
+
+	if err := SetLowConfidence(Prefix, "{{.Nope", ""); err == nil {
+		t.Errorf("a prefix that isn't a template should fail")
+	}
+}
@@ -0,0 +1,72 @@
+package caption
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+)
+
+// Profile is everything besides an image and its language that changes its
+// caption. Cached captions are only used by the Profile that made them.
+type Profile struct {
+	Provider string
+	Model    string
+	// Options are settings like the confidence threshold or template.
+	Options map[string]string
+}
+
+// captionProfile is the Profile of captions made by New.
+var captionProfile = Profile{}
+
+// SetProfile sets the Profile of captions made by New.
+func SetProfile(profile Profile) {
+	captionProfile = profile
+}
+
+// ID fingerprints a Profile. Profiles with the same provider, model and
+// options have the same ID.
+func (p Profile) ID() string {
+	keys := []string{}
+
+	for key := range p.Options {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	hash := sha1.New()
+
+	// a 0 byte can't be in any of the fields, so the fields can't run together
+	hash.Write([]byte(p.Provider + "\x00" + p.Model))
+
+	for _, key := range keys {
+		hash.Write([]byte("\x00" + key + "=" + p.Options[key]))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// legacyOptions are the only options captions cached before profiles existed
+// can be reused with.
+var legacyOptions = map[string]bool{"threshold": true}
+
+// legacy checks if captions cached before profiles existed, which were all
+// made by Azure, can be used for p.
+func (p Profile) legacy() bool {
+	if p.Provider != "azure" {
+		return false
+	}
+
+	for key := range p.Options {
+		if !legacyOptions[key] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// profile returns the Profile a Caption was made with.
+func (c *Caption) profile() Profile {
+	return Profile{Provider: c.Provider, Model: c.Model, Options: c.Options}
+}
@@ -0,0 +1,55 @@
+package caption
+
+// PendingCaptions lists the captions waiting for review, oldest first.
+func PendingCaptions(store Store) ([]*Caption, error) {
+	captions, err := store.Captions()
+
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []*Caption{}
+
+	for _, caption := range captions {
+		if caption.Status == Pending {
+			pending = append(pending, caption)
+		}
+	}
+
+	return pending, nil
+}
+
+// Approve marks a caption as Verified with the description a human chose. It
+// replaces the caption in the store, and is used from then on whatever the
+// Profile.
+func Approve(store Store, caption *Caption, description string) error {
+	key := caption.key()
+
+	verified := *caption
+	verified.Description = description
+	verified.Confidence = 1.0
+	verified.Status = Verified
+
+	// keep the pending caption until the verified one is stored
+	if err := store.Set(&verified); err != nil {
+		return err
+	}
+
+	if _, err := store.Remove(func(c *Caption) bool { return c.key() == key }); err != nil {
+		return err
+	}
+
+	return store.Flush()
+}
+
+// Reject marks a caption as Rejected, so its image keeps the alt it has.
+func Reject(store Store, caption *Caption) error {
+	rejected := *caption
+	rejected.Status = Rejected
+
+	if err := store.Set(&rejected); err != nil {
+		return err
+	}
+
+	return store.Flush()
+}
@@ -0,0 +1,143 @@
+package caption
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/samuelstevens/gocaption/api"
+)
+
+func TestNewQueuesLowConfidence(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+	defer SetProfile(Profile{})
+
+	describer := &fakeDescriber{
+		candidates: []api.Candidate{{Text: "a dog", Confidence: 0.2}, {Text: "a cat", Confidence: 0.1}},
+		err:        &api.ConfidenceError{Confidence: 0.2},
+	}
+	imgPath := writeImage(t, dir, "cat.png", "cat")
+
+	got, err := New(File(imgPath), "", "", describer)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Description != "" || got.Status != Pending {
+		t.Errorf("got %q with status %q, want no alt while pending", got.Description, got.Status)
+	}
+
+	pending, err := PendingCaptions(captionCache)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 1 || pending[0].Description != "a dog" {
+		t.Fatalf("PendingCaptions() == %v, want the low-confidence caption", pending)
+	}
+
+	if got, _ := New(File(imgPath), "", "", describer); got.Description != "" || describer.calls != 1 {
+		t.Errorf("a pending caption should be neither published nor made again")
+	}
+
+	if err := Approve(captionCache, pending[0], pending[0].Candidates[1].Text); err != nil {
+		t.Fatal(err)
+	}
+
+	if pending, _ := PendingCaptions(captionCache); len(pending) != 0 {
+		t.Errorf("approved captions should leave the queue, got %v", pending)
+	}
+
+	// a verified caption is used whatever the profile
+	SetProfile(Profile{Provider: "azure", Options: map[string]string{"template": "{{.Caption}}"}})
+
+	got, err = New(File(imgPath), "", "", describer)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Description != "a cat" || got.Status != Verified || describer.calls != 1 {
+		t.Errorf("got %q with status %q after %d calls, want the verified caption", got.Description, got.Status, describer.calls)
+	}
+}
+
+// unwritableStore is a Store that can't add captions.
+type unwritableStore struct {
+	Store
+}
+
+func (s unwritableStore) Set(caption *Caption) error {
+	return errors.New("disk full")
+}
+
+func TestApproveKeepsPendingOnError(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	describer := &fakeDescriber{
+		candidates: []api.Candidate{{Text: "a dog", Confidence: 0.2}},
+		err:        &api.ConfidenceError{Confidence: 0.2},
+	}
+	imgPath := writeImage(t, dir, "cat.png", "cat")
+
+	if _, err := New(File(imgPath), "", "", describer); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := PendingCaptions(captionCache)
+
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("PendingCaptions() == %v, %v; want one caption", pending, err)
+	}
+
+	if err := Approve(unwritableStore{captionCache}, pending[0], "a cat"); err == nil {
+		t.Fatal("got no error; wanted the store's error")
+	}
+
+	if pending, _ := PendingCaptions(captionCache); len(pending) != 1 {
+		t.Errorf("a caption that couldn't be approved should stay in the queue, got %v", pending)
+	}
+}
+
+func TestReject(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	describer := &fakeDescriber{
+		candidates: []api.Candidate{{Text: "a dog", Confidence: 0.2}},
+		err:        &api.ConfidenceError{Confidence: 0.2},
+	}
+	imgPath := writeImage(t, dir, "cat.png", "cat")
+
+	if _, err := New(File(imgPath), "", "", describer); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := PendingCaptions(captionCache)
+
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("PendingCaptions() == %v, %v; want one caption", pending, err)
+	}
+
+	if err := Reject(captionCache, pending[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if pending, _ := PendingCaptions(captionCache); len(pending) != 0 {
+		t.Errorf("rejected captions should leave the queue, got %v", pending)
+	}
+
+	got, err := New(File(imgPath), "", "", describer)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Description != "" || got.Status != Rejected || describer.calls != 1 {
+		t.Errorf("got %q with status %q after %d calls, want the rejected caption kept out of the page", got.Description, got.Status, describer.calls)
+	}
+}
@@ -0,0 +1,418 @@
+package caption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuelstevens/gocaption/util"
+)
+
+// Source is an image that can be captioned.
+type Source interface {
+	// Name identifies the image, like a path or URL.
+	Name() string
+	Open() (io.ReadCloser, error)
+	// Hash returns the same hash as util.HashFile would for the image's bytes.
+	Hash() (string, error)
+}
+
+// File is an image on disk.
+type File string
+
+// Name returns the path of the File.
+func (f File) Name() string {
+	return string(f)
+}
+
+// Open opens the File.
+func (f File) Open() (io.ReadCloser, error) {
+	return os.Open(string(f))
+}
+
+// Hash hashes the File.
+func (f File) Hash() (string, error) {
+	return util.HashFile(string(f))
+}
+
+// memory is an image that has been loaded into memory.
+type memory struct {
+	data []byte
+	hash string
+}
+
+func newMemory(data []byte) (*memory, error) {
+	hash, err := util.HashReader(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &memory{data, hash}, nil
+}
+
+func (m *memory) Open() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(m.data)), nil
+}
+
+func (m *memory) Hash() (string, error) {
+	return m.hash, nil
+}
+
+// DataURI is an image inlined in a page like "data:image/png;base64,...".
+type DataURI struct {
+	*memory
+	mediaType string
+}
+
+// NewDataURI decodes a data URI.
+func NewDataURI(uri string) (*DataURI, error) {
+	if !strings.HasPrefix(strings.ToLower(uri), "data:") {
+		return nil, &DataURIError{"missing data: prefix"}
+	}
+
+	comma := strings.Index(uri, ",")
+
+	if comma < 0 {
+		return nil, &DataURIError{"missing ','"}
+	}
+
+	header := uri[len("data:"):comma]
+	payload := uri[comma+1:]
+
+	isBase64 := false
+	mediaType := "text/plain"
+
+	for i, part := range strings.Split(header, ";") {
+		switch {
+		case i == 0 && part != "":
+			mediaType = strings.ToLower(part)
+		case strings.EqualFold(part, "base64"):
+			isBase64 = true
+		}
+	}
+
+	unescaped, err := url.PathUnescape(payload)
+
+	if err != nil {
+		return nil, &DataURIError{err.Error()}
+	}
+
+	data := []byte(unescaped)
+
+	if isBase64 {
+		// whitespace is common in hand-written data URIs
+		unescaped = strings.Join(strings.Fields(unescaped), "")
+		data, err = base64.StdEncoding.DecodeString(unescaped)
+
+		if err != nil {
+			data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(unescaped, "="))
+		}
+
+		if err != nil {
+			return nil, &DataURIError{err.Error()}
+		}
+	}
+
+	m, err := newMemory(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataURI{m, mediaType}, nil
+}
+
+// Name returns a short name for the data URI that is unique to its contents.
+func (d *DataURI) Name() string {
+	return fmt.Sprintf("data:%s;sha1=%s", d.mediaType, d.hash)
+}
+
+// Fetcher downloads remote images.
+type Fetcher struct {
+	Client *http.Client
+	// MaxBytes is the largest image that will be downloaded.
+	MaxBytes int64
+	// AllowedHosts lists the hosts images can be downloaded from. "*" allows
+	// any host.
+	AllowedHosts *util.StringSet
+}
+
+// NewFetcher returns a Fetcher.
+func NewFetcher(allowedHosts []string, timeout time.Duration, maxBytes int64) *Fetcher {
+	hosts := util.NewStringSet([]string{})
+
+	for _, host := range allowedHosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			(*hosts)[host] = util.Exists
+		}
+	}
+
+	f := &Fetcher{
+		MaxBytes:     maxBytes,
+		AllowedHosts: hosts,
+	}
+
+	f.Client = &http.Client{Timeout: timeout, CheckRedirect: f.checkRedirect}
+
+	return f
+}
+
+func (f *Fetcher) allowed(host string) bool {
+	return f.AllowedHosts.Contains("*") || f.AllowedHosts.Contains(strings.ToLower(host))
+}
+
+// checkRedirect holds every redirect to the same rules as the first URL, so
+// an allowed host can't send a request to one that isn't.
+func (f *Fetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return &FetchError{req.URL.String(), "too many redirects"}
+	}
+
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return &FetchError{req.URL.String(), "only http and https URLs can be fetched"}
+	}
+
+	if !f.allowed(req.URL.Hostname()) {
+		return &FetchError{req.URL.String(), fmt.Sprintf("redirected to host %s, which is not allowed", req.URL.Hostname())}
+	}
+
+	return nil
+}
+
+// Remote is an image at an http(s) URL. It is downloaded at most once.
+type Remote struct {
+	url     string
+	fetcher *Fetcher
+
+	once   sync.Once
+	memory *memory
+	err    error
+}
+
+// NewRemote returns a Remote image if its host is allowed.
+func (f *Fetcher) NewRemote(rawURL string) (*Remote, error) {
+	parsed, err := url.Parse(rawURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, &FetchError{rawURL, "only http and https URLs can be fetched"}
+	}
+
+	if !f.allowed(parsed.Hostname()) {
+		return nil, &FetchError{rawURL, fmt.Sprintf("host %s is not allowed", parsed.Hostname())}
+	}
+
+	return &Remote{url: rawURL, fetcher: f}, nil
+}
+
+// Name returns the URL of the image.
+func (r *Remote) Name() string {
+	return r.url
+}
+
+func (r *Remote) fetch() (*memory, error) {
+	r.once.Do(func() {
+		resp, err := r.fetcher.Client.Get(r.url)
+
+		if err != nil {
+			r.err = err
+			return
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			r.err = &FetchError{r.url, resp.Status}
+			return
+		}
+
+		if resp.ContentLength > r.fetcher.MaxBytes {
+			r.err = &FetchError{r.url, fmt.Sprintf("image is larger than %d bytes", r.fetcher.MaxBytes)}
+			return
+		}
+
+		// read one byte past the limit to tell if the image is too large
+		data, err := ioutil.ReadAll(io.LimitReader(resp.Body, r.fetcher.MaxBytes+1))
+
+		if err != nil {
+			r.err = err
+			return
+		}
+
+		if int64(len(data)) > r.fetcher.MaxBytes {
+			r.err = &FetchError{r.url, fmt.Sprintf("image is larger than %d bytes", r.fetcher.MaxBytes)}
+			return
+		}
+
+		r.memory, r.err = newMemory(data)
+	})
+
+	return r.memory, r.err
+}
+
+// Open downloads the image, if it hasn't been already.
+func (r *Remote) Open() (io.ReadCloser, error) {
+	m, err := r.fetch()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Open()
+}
+
+// Hash downloads the image, if it hasn't been already, and hashes it.
+func (r *Remote) Hash() (string, error) {
+	m, err := r.fetch()
+
+	if err != nil {
+		return "", err
+	}
+
+	return m.Hash()
+}
+
+// Resolver turns an image reference in a page into a Source, following URL
+// semantics. A nil Resolver only resolves local files and data URIs, and
+// can't resolve root-relative references like "/img/a.png".
+type Resolver struct {
+	// Fetcher downloads remote images; if it is nil remote images are skipped.
+	Fetcher *Fetcher
+	// SiteRoot is the directory root-relative references resolve against.
+	SiteRoot string
+	// Guess looks for references that can't be found in every ancestor of the
+	// page's directory. A guess can match an unrelated file, so it is opt-in.
+	Guess bool
+	// OnGuess is called with every path found by guessing.
+	OnGuess func(pagePath string, ref string, guess string)
+}
+
+// Resolve finds the Source for an image reference in the page at pagePath.
+func (r *Resolver) Resolve(pagePath string, ref string) (Source, error) {
+	return r.ResolveBase(pagePath, "", ref)
+}
+
+// ResolveBase is like Resolve, but resolves ref against base (from a page's
+// <base href>) if it isn't empty. base itself resolves against the page.
+func (r *Resolver) ResolveBase(pagePath string, base string, ref string) (Source, error) {
+	ref = strings.TrimSpace(ref)
+
+	if strings.HasPrefix(strings.ToLower(ref), "data:") {
+		return NewDataURI(ref)
+	}
+
+	refURL, err := url.Parse(ref)
+
+	if err != nil {
+		return nil, &ResolveError{ref, err.Error()}
+	}
+
+	pageURL, rooted := r.pageURL(pagePath)
+	resolved := pageURL
+	rootRelative := strings.HasPrefix(refURL.Path, "/")
+
+	if base = strings.TrimSpace(base); base != "" {
+		baseURL, err := url.Parse(base)
+
+		if err != nil {
+			return nil, &ResolveError{base, err.Error()}
+		}
+
+		resolved = resolved.ResolveReference(baseURL)
+		rootRelative = rootRelative || strings.HasPrefix(baseURL.Path, "/")
+	}
+
+	resolved = resolved.ResolveReference(refURL)
+
+	if resolved.Scheme == "" && resolved.Host != "" {
+		// a scheme-relative URL like "//example.com/a.png"
+		resolved.Scheme = "https"
+	}
+
+	switch resolved.Scheme {
+	case "":
+	case "http", "https":
+		if r == nil || r.Fetcher == nil {
+			return nil, &FetchError{resolved.String(), "remote images are disabled"}
+		}
+
+		return r.Fetcher.NewRemote(resolved.String())
+	default:
+		return nil, &ResolveError{ref, fmt.Sprintf("%s: URLs aren't supported", resolved.Scheme)}
+	}
+
+	// a root-relative reference means nothing without a site root
+	if rooted || !rootRelative {
+		absImgPath := filepath.FromSlash(resolved.Path)
+
+		if rooted {
+			absImgPath = filepath.Join(r.SiteRoot, absImgPath)
+		}
+
+		if _, err := os.Stat(absImgPath); err == nil {
+			return File(absImgPath), nil
+		}
+	}
+
+	if r == nil || !r.Guess {
+		if rootRelative && !rooted {
+			return nil, &ResolveError{ref, "root-relative paths need a site root"}
+		}
+
+		return nil, &ResolveError{ref, "not found on disk"}
+	}
+
+	guess, err := util.MakeAbsRelativeTo(pagePath, refURL.Path)
+
+	if err != nil {
+		return nil, &ResolveError{ref, "not found on disk"}
+	}
+
+	if r.OnGuess != nil {
+		r.OnGuess(pagePath, ref, guess)
+	}
+
+	return File(guess), nil
+}
+
+// pageURL returns the URL of a page, relative to the site root if the page is
+// inside it, otherwise its absolute path.
+func (r *Resolver) pageURL(pagePath string) (*url.URL, bool) {
+	if r != nil && r.SiteRoot != "" {
+		rel, err := filepath.Rel(r.SiteRoot, pagePath)
+
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return &url.URL{Path: "/" + filepath.ToSlash(rel)}, true
+		}
+	}
+
+	return &url.URL{Path: filepath.ToSlash(pagePath)}, false
+}
+
+// baseName is a short name for a Source to show to users.
+func baseName(source Source) string {
+	switch s := source.(type) {
+	case File:
+		return filepath.Base(string(s))
+	case *Remote:
+		if parsed, err := url.Parse(s.url); err == nil && path.Base(parsed.Path) != "/" {
+			return path.Base(parsed.Path)
+		}
+	}
+
+	return source.Name()
+}
@@ -0,0 +1,320 @@
+package caption
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuelstevens/gocaption/util"
+)
+
+func TestDataURI(t *testing.T) {
+	cases := []struct {
+		uri  string
+		want string
+		name string
+	}{
+		{"data:image/png;base64,Y2F0", "cat", "data:image/png;sha1="},
+		{"data:image/png;base64,Y2\n F0", "cat", "data:image/png;sha1="},
+		{"data:IMAGE/SVG+XML,%3Csvg%3E", "<svg>", "data:image/svg+xml;sha1="},
+		{"data:,cat", "cat", "data:text/plain;sha1="},
+	}
+
+	for _, c := range cases {
+		d, err := NewDataURI(c.uri)
+
+		if err != nil {
+			t.Errorf("NewDataURI(%q) failed: %s", c.uri, err)
+			continue
+		}
+
+		r, _ := d.Open()
+		got, _ := ioutil.ReadAll(r)
+
+		if string(got) != c.want {
+			t.Errorf("NewDataURI(%q) decoded %q, want %q", c.uri, got, c.want)
+		}
+
+		if !strings.HasPrefix(d.Name(), c.name) {
+			t.Errorf("NewDataURI(%q).Name() == %q, want prefix %q", c.uri, d.Name(), c.name)
+		}
+	}
+
+	for _, uri := range []string{"data:image/png;base64", "data:image/png;base64,!!!", "image.png"} {
+		if _, err := NewDataURI(uri); err == nil {
+			t.Errorf("NewDataURI(%q) should fail", uri)
+		}
+	}
+}
+
+func TestHashesMatch(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	want, err := util.HashFile(writeImage(t, dir, "a.png", "cat"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDataURI("data:image/png;base64,Y2F0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := d.Hash(); got != want {
+		t.Errorf("data URI hash %s, want %s", got, want)
+	}
+}
+
+func TestRemote(t *testing.T) {
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		switch r.URL.Path {
+		case "/cat.png":
+			w.Write([]byte("cat"))
+		case "/big.png":
+			w.Write([]byte(strings.Repeat("x", 100)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	parsed, _ := url.Parse(server.URL)
+	fetcher := NewFetcher([]string{parsed.Hostname()}, time.Second, 10)
+
+	remote, err := fetcher.NewRemote(server.URL + "/cat.png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := remote.Hash()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, _ := util.HashReader(strings.NewReader("cat")); hash != want {
+		t.Errorf("remote hash %s, want %s", hash, want)
+	}
+
+	r, err := remote.Open()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := ioutil.ReadAll(r); string(got) != "cat" {
+		t.Errorf("remote contents %q, want %q", got, "cat")
+	}
+
+	if requests != 1 {
+		t.Errorf("made %d requests, want 1", requests)
+	}
+
+	for _, path := range []string{"/big.png", "/missing.png"} {
+		remote, err := fetcher.NewRemote(server.URL + path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := remote.Hash(); err == nil {
+			t.Errorf("fetching %s should fail", path)
+		}
+	}
+
+	other := NewFetcher([]string{"example.com"}, time.Second, 10)
+
+	if _, err := other.NewRemote(server.URL + "/cat.png"); err == nil {
+		t.Errorf("fetching from a host that isn't allowed should fail")
+	}
+
+	anyHost := NewFetcher([]string{"*"}, time.Second, 10)
+
+	if _, err := anyHost.NewRemote(server.URL + "/cat.png"); err != nil {
+		t.Errorf("* should allow any host: %s", err)
+	}
+}
+
+func TestRemoteRedirects(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer internal.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved.png":
+			http.Redirect(w, r, "/cat.png", http.StatusFound)
+		case "/internal.png":
+			// the same server by another name, which isn't allowed
+			http.Redirect(w, r, strings.Replace(internal.URL, "127.0.0.1", "localhost", 1)+"/cat.png", http.StatusFound)
+		case "/file.png":
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+		default:
+			w.Write([]byte("cat"))
+		}
+	}))
+	defer server.Close()
+
+	parsed, _ := url.Parse(server.URL)
+	fetcher := NewFetcher([]string{parsed.Hostname()}, time.Second, 10)
+
+	for path, ok := range map[string]bool{"/moved.png": true, "/internal.png": false, "/file.png": false} {
+		remote, err := fetcher.NewRemote(server.URL + path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = remote.Hash()
+
+		if ok && err != nil {
+			t.Errorf("following a redirect from %s to an allowed host failed: %s", path, err)
+		}
+
+		if !ok && err == nil {
+			t.Errorf("following a redirect from %s should fail", path)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	page := writeImage(t, dir, "index.html", "<img src=cat.png>")
+	imgPath := writeImage(t, dir, "cat.png", "cat")
+
+	var resolver *Resolver
+
+	source, err := resolver.Resolve(page, "cat.png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if source.Name() != imgPath {
+		t.Errorf("resolved %s, want %s", source.Name(), imgPath)
+	}
+
+	if _, err := resolver.Resolve(page, "https://example.com/cat.png"); err == nil {
+		t.Errorf("a nil Resolver should not fetch remote images")
+	}
+
+	resolver = &Resolver{Fetcher: NewFetcher([]string{"example.com"}, time.Second, 10)}
+
+	source, err = resolver.Resolve(page, "//example.com/cat.png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if source.Name() != "https://example.com/cat.png" {
+		t.Errorf("resolved %s, want https://example.com/cat.png", source.Name())
+	}
+}
+
+func TestResolveSiteRoot(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "site", "blog", "images"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "site", "images"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	root := filepath.Join(dir, "site")
+	page := writeImage(t, root, filepath.Join("blog", "post.html"), "")
+	rootCat := writeImage(t, root, filepath.Join("images", "cat.png"), "cat")
+	blogCat := writeImage(t, root, filepath.Join("blog", "images", "cat.png"), "cat")
+	spaced := writeImage(t, root, filepath.Join("images", "my cat.png"), "cat")
+
+	cases := []struct {
+		resolver *Resolver
+		base     string
+		ref      string
+		want     string
+	}{
+		{&Resolver{SiteRoot: root}, "", "/images/cat.png", rootCat},
+		{&Resolver{SiteRoot: root}, "", "images/cat.png", blogCat},
+		{&Resolver{SiteRoot: root}, "", "../images/cat.png", rootCat},
+		{&Resolver{SiteRoot: root}, "", "../../../images/cat.png", rootCat},
+		{&Resolver{SiteRoot: root}, "", "images/cat.png?v=2#top", blogCat},
+		{&Resolver{SiteRoot: root}, "", "/images/my%20cat.png", spaced},
+		{&Resolver{SiteRoot: root}, "/", "images/cat.png", rootCat},
+		{&Resolver{SiteRoot: root}, "../", "images/cat.png", rootCat},
+		{&Resolver{}, "", "images/cat.png", blogCat},
+		{&Resolver{}, "", "/images/cat.png", ""},
+		{&Resolver{SiteRoot: root}, "", "/blog/missing.png", ""},
+		{&Resolver{SiteRoot: root}, "", "mailto:me@example.com", ""},
+		// guessing finds the nearest match, which may not be the right one
+		{&Resolver{Guess: true}, "", "/images/cat.png", blogCat},
+	}
+
+	for _, c := range cases {
+		source, err := c.resolver.ResolveBase(page, c.base, c.ref)
+
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("resolving %q with base %q should fail, got %s", c.ref, c.base, source.Name())
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("resolving %q with base %q failed: %s", c.ref, c.base, err)
+			continue
+		}
+
+		if source.Name() != c.want {
+			t.Errorf("resolved %q with base %q to %s, want %s", c.ref, c.base, source.Name(), c.want)
+		}
+	}
+}
+
+func TestResolveReportsGuesses(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	page := writeImage(t, dir, "index.html", "")
+	writeImage(t, dir, "cat.png", "cat")
+
+	guesses := 0
+	resolver := &Resolver{Guess: true, OnGuess: func(pagePath string, ref string, guess string) {
+		guesses++
+	}}
+
+	if _, err := resolver.Resolve(page, "cat.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	if guesses != 0 {
+		t.Errorf("an exact match was reported as a guess")
+	}
+
+	if _, err := resolver.Resolve(page, "/cat.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	if guesses != 1 {
+		t.Errorf("got %d guesses, want 1", guesses)
+	}
+}
@@ -0,0 +1,226 @@
+package caption
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	// registers the "sqlite" driver
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS captions (
+	key      TEXT PRIMARY KEY,
+	hash     TEXT NOT NULL,
+	language TEXT NOT NULL,
+	profile  TEXT NOT NULL,
+	source   TEXT NOT NULL,
+	provider TEXT NOT NULL,
+	created  TEXT NOT NULL,
+	caption  TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS captions_created ON captions (created);
+`
+
+// SQLiteStore is a Store saved in a SQLite database. Unlike a JSONStore, each
+// caption is written as soon as it is set, and only the captions that are
+// looked up are read, so it suits large caches and concurrent runs.
+type SQLiteStore struct {
+	db *sql.DB
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// OpenSQLiteStore opens the SQLite database at cacheFilepath, creating it if
+// it doesn't exist.
+func OpenSQLiteStore(cacheFilepath string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", cacheFilepath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows one writer at a time anyway
+	db.SetMaxOpenConns(1)
+
+	for _, statement := range []string{"PRAGMA journal_mode=WAL", "PRAGMA busy_timeout=5000", sqliteSchema} {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, &CorruptCacheError{cacheFilepath, err}
+		}
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// Get looks up a caption by its image hash, language and Profile.
+func (s *SQLiteStore) Get(hash string, language string, profile Profile) (*Caption, bool) {
+	for _, key := range lookupKeys(hash, language, profile) {
+		if caption, ok := s.get(key); ok {
+			return caption, true
+		}
+	}
+
+	return nil, false
+}
+
+func (s *SQLiteStore) get(key string) (*Caption, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, false
+	}
+
+	var jsonRep string
+
+	if err := s.db.QueryRow("SELECT caption FROM captions WHERE key = ?", key).Scan(&jsonRep); err != nil {
+		return nil, false
+	}
+
+	caption := &Caption{}
+
+	if err := json.Unmarshal([]byte(jsonRep), caption); err != nil {
+		return nil, false
+	}
+
+	return caption, true
+}
+
+// Set adds a caption to the SQLiteStore, replacing any with the same key.
+func (s *SQLiteStore) Set(caption *Caption) error {
+	if caption.Description == "" {
+		return nil
+	}
+
+	jsonRep, err := json.Marshal(caption)
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrCacheClosed
+	}
+
+	_, err = s.db.Exec(
+		"INSERT OR REPLACE INTO captions (key, hash, language, profile, source, provider, created, caption) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		caption.key(), caption.Hash, caption.Language, caption.profile().ID(), caption.Source, caption.Provider,
+		caption.Created.UTC().Format(time.RFC3339Nano), string(jsonRep),
+	)
+
+	return err
+}
+
+// Captions lists every caption in the SQLiteStore, oldest first.
+func (s *SQLiteStore) Captions() ([]*Caption, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrCacheClosed
+	}
+
+	_, captions, err := s.all()
+
+	return captions, err
+}
+
+// all must be called while holding s.mu.
+func (s *SQLiteStore) all() ([]string, []*Caption, error) {
+	rows, err := s.db.Query("SELECT key, caption FROM captions ORDER BY created, key")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	keys := []string{}
+	captions := []*Caption{}
+
+	for rows.Next() {
+		var key, jsonRep string
+
+		if err := rows.Scan(&key, &jsonRep); err != nil {
+			return nil, nil, err
+		}
+
+		caption := &Caption{}
+
+		if err := json.Unmarshal([]byte(jsonRep), caption); err != nil {
+			return nil, nil, err
+		}
+
+		keys = append(keys, key)
+		captions = append(captions, caption)
+	}
+
+	return keys, captions, rows.Err()
+}
+
+// Remove deletes every caption that matches and returns how many were
+// removed.
+func (s *SQLiteStore) Remove(match func(caption *Caption) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, ErrCacheClosed
+	}
+
+	keys, captions, err := s.all()
+
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+
+	for i, caption := range captions {
+		if !match(caption) {
+			continue
+		}
+
+		if _, err := tx.Exec("DELETE FROM captions WHERE key = ?", keys[i]); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		removed++
+	}
+
+	return removed, tx.Commit()
+}
+
+// Flush does nothing, since captions are written as soon as they are set.
+func (s *SQLiteStore) Flush() error {
+	return nil
+}
+
+// Close closes the database. Captions can't be added after a SQLiteStore is
+// closed.
+func (s *SQLiteStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	s.closed = true
+
+	return s.db.Close()
+}
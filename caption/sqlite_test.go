@@ -0,0 +1,108 @@
+package caption
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStoreRoundTrip(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "captions.db")
+
+	cache, err := OpenSQLiteStore(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			if err := cache.Set(&Caption{Hash: string(rune('A' + i)), Description: "a cat"}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	cache.Set(&Caption{Hash: "old", Description: "an old cat", Created: created})
+
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cache.Set(&Caption{Hash: "late", Description: "a dog"}); err != ErrCacheClosed {
+		t.Errorf("got error %v; wanted %v", err, ErrCacheClosed)
+	}
+
+	reopened, err := OpenSQLiteStore(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reopened.Close()
+
+	captions, err := reopened.Captions()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(captions) != 51 {
+		t.Errorf("reopened cache has %d captions, want 51", len(captions))
+	}
+
+	if c, ok := reopened.Get("old", "", Profile{}); !ok || !c.Created.Equal(created) {
+		t.Errorf("got %+v, want the old caption", c)
+	}
+}
+
+func TestSQLiteStoreProfiles(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	cache, err := OpenSQLiteStore(filepath.Join(dir, "captions.db"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer cache.Close()
+
+	azure := Profile{Provider: "azure", Model: "v2", Options: map[string]string{"threshold": "0.5"}}
+	templated := Profile{Provider: "azure", Model: "v2", Options: map[string]string{"threshold": "0.5", "template": "{{.Caption}}"}}
+
+	// a caption migrated from before profiles existed
+	cache.Set(&Caption{Hash: "abc", Description: "a cat"})
+
+	if c, ok := cache.Get("abc", "", azure); !ok || c.Description != "a cat" {
+		t.Errorf("legacy captions should be reused by Azure with default options")
+	}
+
+	if _, ok := cache.Get("abc", "", templated); ok {
+		t.Errorf("legacy captions shouldn't be reused with a template")
+	}
+
+	cache.Set(&Caption{Hash: "abc", Description: "a templated cat", Provider: "azure", Model: "v2", Options: templated.Options})
+
+	if c, ok := cache.Get("abc", "", templated); !ok || c.Description != "a templated cat" {
+		t.Errorf("got %+v, want the templated caption", c)
+	}
+
+	if _, ok := cache.Get("abc", "", Profile{Provider: "ollama"}); ok {
+		t.Errorf("legacy captions shouldn't be reused by other providers")
+	}
+}
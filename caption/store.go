@@ -0,0 +1,133 @@
+package caption
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store is where captions are cached. Implementations are safe to use from
+// multiple goroutines.
+type Store interface {
+	// Get looks up a caption by its image hash, language and Profile. A
+	// Verified caption is found whatever the Profile.
+	Get(hash string, language string, profile Profile) (*Caption, bool)
+	// Set adds a caption, replacing any with the same hash, language and
+	// Profile.
+	Set(caption *Caption) error
+	// Captions lists every caption, oldest first.
+	Captions() ([]*Caption, error)
+	// Remove deletes every caption that matches and returns how many were
+	// removed.
+	Remove(match func(caption *Caption) bool) (int, error)
+	// Flush writes any pending captions.
+	Flush() error
+	// Close flushes the Store. Captions can't be added after it is closed.
+	Close() error
+}
+
+// sqliteExtensions are the cache file extensions that use a SQLiteStore.
+var sqliteExtensions = map[string]bool{".db": true, ".sqlite": true, ".sqlite3": true}
+
+// OpenCache opens the Store at cacheFilepath, which is a SQLiteStore for
+// files ending in .db, .sqlite or .sqlite3 and a JSONStore otherwise.
+func OpenCache(cacheFilepath string) (Store, error) {
+	if sqliteExtensions[strings.ToLower(filepath.Ext(cacheFilepath))] {
+		return OpenSQLiteStore(cacheFilepath)
+	}
+
+	return OpenJSONStore(cacheFilepath)
+}
+
+var captionCache Store
+
+// InitializeCache opens the Store used by New.
+func InitializeCache(cacheFilepath string) error {
+	if captionCache != nil {
+		return nil
+	}
+
+	cache, err := OpenCache(cacheFilepath)
+
+	if err != nil {
+		return err
+	}
+
+	captionCache = cache
+
+	return nil
+}
+
+// CloseCache closes the Store used by New.
+func CloseCache() error {
+	if captionCache == nil {
+		return nil
+	}
+
+	return captionCache.Close()
+}
+
+// verifiedID takes the place of a Profile ID in the keys of Verified
+// captions, since they are used whatever Profile is asked for.
+const verifiedID = "verified"
+
+// cacheKey is where a caption is stored in a Store.
+func cacheKey(hash string, language string, profileID string) string {
+	return hash + "|" + strings.ToLower(language) + "|" + profileID
+}
+
+// key is where a caption is stored in a Store.
+func (c *Caption) key() string {
+	if c.Status == Verified {
+		return cacheKey(c.Hash, c.Language, verifiedID)
+	}
+
+	return cacheKey(c.Hash, c.Language, c.profile().ID())
+}
+
+// lookupKeys are where a Store looks for a caption, in order: a caption
+// verified by a human, then one made with profile, then, if profile can use
+// them, one cached before profiles existed.
+func lookupKeys(hash string, language string, profile Profile) []string {
+	keys := []string{cacheKey(hash, language, verifiedID), cacheKey(hash, language, profile.ID())}
+
+	if profile.legacy() {
+		keys = append(keys, cacheKey(hash, language, Profile{}.ID()))
+	}
+
+	return keys
+}
+
+// Prune removes the captions of local images that no longer exist. Captions
+// of remote images, data URIs and captions without a Source are kept.
+func Prune(store Store) (int, error) {
+	return store.Remove(func(caption *Caption) bool {
+		source := caption.Source
+
+		if source == "" || strings.HasPrefix(source, "data:") || strings.Contains(source, "://") {
+			return false
+		}
+
+		_, err := os.Stat(source)
+
+		return os.IsNotExist(err)
+	})
+}
+
+// Migrate copies every caption from one Store to another and returns how
+// many were copied.
+func Migrate(from Store, to Store) (int, error) {
+	captions, err := from.Captions()
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, caption := range captions {
+		if err := to.Set(caption); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(captions), to.Flush()
+}
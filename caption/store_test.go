@@ -0,0 +1,132 @@
+package caption
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenCache(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	for name, want := range map[string]string{"cache.json": "json", "cache.db": "sqlite", "cache.SQLite3": "sqlite"} {
+		cache, err := OpenCache(filepath.Join(dir, name))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := "json"
+
+		if _, ok := cache.(*SQLiteStore); ok {
+			got = "sqlite"
+		}
+
+		if got != want {
+			t.Errorf("OpenCache(%q) opened a %s store, want %s", name, got, want)
+		}
+
+		cache.Close()
+	}
+}
+
+func TestStoreRemoveAndPrune(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	kept := writeImage(t, dir, "kept.png", "kept")
+
+	for _, name := range []string{"cache.json", "cache.db"} {
+		cache, err := OpenCache(filepath.Join(dir, name))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, c := range []*Caption{
+			{Hash: "a", Description: "kept", Source: kept},
+			{Hash: "b", Description: "gone", Source: filepath.Join(dir, "gone.png")},
+			{Hash: "c", Description: "remote", Source: "https://example.com/gone.png"},
+			{Hash: "d", Description: "legacy"},
+		} {
+			cache.Set(c)
+		}
+
+		if removed, err := Prune(cache); err != nil || removed != 1 {
+			t.Errorf("%s: Prune() == %d, %v; want 1", name, removed, err)
+		}
+
+		removed, err := cache.Remove(func(c *Caption) bool { return c.Hash == "c" })
+
+		if err != nil || removed != 1 {
+			t.Errorf("%s: Remove() == %d, %v; want 1", name, removed, err)
+		}
+
+		captions, err := cache.Captions()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := []string{}
+
+		for _, c := range captions {
+			got = append(got, c.Description)
+		}
+
+		if len(got) != 2 || got[0] != "kept" || got[1] != "legacy" {
+			t.Errorf("%s: Captions() == %v, want [kept legacy]", name, got)
+		}
+
+		cache.Close()
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+
+	from, err := OpenCache(filepath.Join(dir, "cache.json"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	templated := Profile{Provider: "azure", Model: "v2", Options: map[string]string{"template": "{{.Caption}}"}}
+
+	from.Set(&Caption{Hash: "abc", Description: "a cat"})
+	from.Set(&Caption{Hash: "abc", Language: "es", Description: "un gato"})
+	from.Set(&Caption{Hash: "abc", Description: "a templated cat", Provider: "azure", Model: "v2", Options: templated.Options})
+
+	to, err := OpenCache(filepath.Join(dir, "cache.db"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if copied, err := Migrate(from, to); err != nil || copied != 3 {
+		t.Errorf("Migrate() == %d, %v; want 3", copied, err)
+	}
+
+	from.Close()
+	to.Close()
+
+	reopened, err := OpenCache(filepath.Join(dir, "cache.db"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reopened.Close()
+
+	azure := Profile{Provider: "azure", Options: map[string]string{"threshold": "0.5"}}
+
+	if c, ok := reopened.Get("abc", "ES", azure); !ok || c.Description != "un gato" {
+		t.Errorf("got %+v, want the Spanish caption", c)
+	}
+
+	if c, ok := reopened.Get("abc", "", templated); !ok || c.Description != "a templated cat" {
+		t.Errorf("got %+v, want the templated caption", c)
+	}
+}
@@ -0,0 +1,131 @@
+package caption
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/samuelstevens/gocaption/api"
+)
+
+// TemplateData is what a template can use to build a description. For
+// example:
+//
+//	{{.Caption}}{{if .TextHeavy}}, reading "{{truncate .Text 100}}"{{end}}{{with .Brands}} ({{join . ", "}}){{end}}
+type TemplateData struct {
+	// Caption is the most confident candidate.
+	Caption    string
+	Confidence float64
+	Candidates []string
+	api.Details
+}
+
+func newTemplateData(caption string, confidence float64, candidates []api.Candidate, details api.Details) TemplateData {
+	data := TemplateData{
+		Caption:    caption,
+		Confidence: confidence,
+		Details:    details,
+	}
+
+	for _, candidate := range candidates {
+		data.Candidates = append(data.Candidates, candidate.Text)
+	}
+
+	return data
+}
+
+// templateData is the TemplateData of a caption that has already been made.
+func (c *Caption) templateData() TemplateData {
+	details := api.Details{}
+
+	if c.Details != nil {
+		details = *c.Details
+	}
+
+	return newTemplateData(c.Description, c.Confidence, c.Candidates, details)
+}
+
+var templateFuncs = template.FuncMap{
+	"join":     strings.Join,
+	"truncate": truncate,
+}
+
+// captionTemplate builds descriptions in New; if it is nil the best
+// candidate is used as is, along with the text of text-heavy images.
+var captionTemplate *template.Template
+
+// textLength is the most characters of recognized text put in a description
+// without a template.
+var textLength = 150
+
+// SetTextLength sets how much recognized text goes into the description of
+// a text-heavy image when there is no template.
+func SetTextLength(length int) {
+	textLength = length
+}
+
+// truncate shortens text to at most length characters, cutting at a word
+// boundary when it can and marking the cut with "…".
+func truncate(text string, length int) string {
+	runes := []rune(text)
+
+	if length <= 0 || len(runes) <= length {
+		return text
+	}
+
+	cut := string(runes[:length-1])
+
+	if space := strings.LastIndex(cut, " "); space > len(cut)/2 {
+		cut = cut[:space]
+	}
+
+	return strings.TrimRight(cut, " .,;:") + "…"
+}
+
+// SetTemplate parses a text/template used to build every new description
+// from a TemplateData. An empty text uses the best candidate as is.
+func SetTemplate(text string) error {
+	if text == "" {
+		captionTemplate = nil
+		return nil
+	}
+
+	tmpl, err := template.New("caption").Funcs(templateFuncs).Parse(text)
+
+	if err != nil {
+		return err
+	}
+
+	captionTemplate = tmpl
+
+	return nil
+}
+
+// render builds a description from the best candidate and details of a
+// description, which must have at least one candidate.
+func render(description *api.Description) (string, error) {
+	best, err := description.Best()
+
+	if err != nil {
+		return "", err
+	}
+
+	if captionTemplate == nil {
+		if description.TextHeavy {
+			return fmt.Sprintf("%s that reads \"%s\"", best.Text, truncate(description.Text, textLength)), nil
+		}
+
+		return best.Text, nil
+	}
+
+	data := newTemplateData(best.Text, best.Confidence, description.Candidates, description.Details)
+
+	var builder strings.Builder
+
+	if err := captionTemplate.Execute(&builder, data); err != nil {
+		return "", err
+	}
+
+	// OCR text and templates are full of line breaks that don't belong in an alt
+	return strings.Join(strings.Fields(builder.String()), " "), nil
+}
@@ -0,0 +1,106 @@
+package caption
+
+import (
+	"os"
+	"testing"
+
+	"github.com/samuelstevens/gocaption/api"
+)
+
+func TestTemplate(t *testing.T) {
+	defer SetTemplate("")
+
+	describer := &fakeDescriber{
+		candidates: []api.Candidate{{Text: "a screenshot", Confidence: 0.9}, {Text: "a window", Confidence: 0.5}},
+		details: api.Details{
+			Brands: []string{"Acme", "Initech"},
+			Text:   "Save\nchanges?",
+		},
+	}
+
+	cases := []struct {
+		template string
+		want     string
+	}{
+		{"", "a screenshot"},
+		{`{{.Caption}}{{with .Text}}, reading "{{.}}"{{end}}`, `a screenshot, reading "Save changes?"`},
+		{`{{.Caption}} ({{join .Brands ", "}})`, "a screenshot (Acme, Initech)"},
+		{`{{join .Candidates " or "}}{{with .Tags}} tagged {{join . ", "}}{{end}}`, "a screenshot or a window"},
+	}
+
+	for i, c := range cases {
+		dir := setupCache(t)
+		defer os.RemoveAll(dir)
+
+		if err := SetTemplate(c.template); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := New(File(writeImage(t, dir, "image.png", string(rune('a'+i)))), "", "", describer)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Description != c.want {
+			t.Errorf("template %q made %q, want %q", c.template, got.Description, c.want)
+		}
+
+		if len(got.Candidates) != 2 || got.Details == nil || got.Details.Text != "Save\nchanges?" {
+			t.Errorf("New should keep every candidate and detail, got %+v", got)
+		}
+	}
+
+	if err := SetTemplate("{{.Caption"); err == nil {
+		t.Errorf("SetTemplate should fail to parse a bad template")
+	}
+}
+
+func TestTextHeavy(t *testing.T) {
+	dir := setupCache(t)
+	defer os.RemoveAll(dir)
+	defer SetTextLength(150)
+
+	SetTextLength(20)
+
+	describer := &fakeDescriber{
+		candidates: []api.Candidate{{Text: "a screenshot of a computer", Confidence: 0.9}},
+		details:    api.Details{Text: "$ go test ./... ok all packages passed", TextHeavy: true},
+	}
+
+	got, err := New(File(writeImage(t, dir, "terminal.png", "terminal")), "", "", describer)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `a screenshot of a computer that reads "$ go test ./... ok…"`
+
+	if got.Description != want {
+		t.Errorf("New().Description == %q, want %q", got.Description, want)
+	}
+
+	if got.Details == nil || got.Details.Text != describer.details.Text {
+		t.Errorf("New() should keep all of the recognized text, got %+v", got.Details)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		text   string
+		length int
+		want   string
+	}{
+		{"short", 10, "short"},
+		{"one two three four", 12, "one two…"},
+		{"supercalifragilistic", 10, "supercali…"},
+		{"日本語のテキスト", 5, "日本語の…"},
+		{"anything", 0, "anything"},
+	}
+
+	for _, c := range cases {
+		if got := truncate(c.text, c.length); got != c.want {
+			t.Errorf("truncate(%q, %d) == %q, want %q", c.text, c.length, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/samuelstevens/gocaption/util"
+)
+
+const (
+	auditUsage = `Usage: gocaption audit [options] <file or directory...>
+
+Finds images in HTML and Markdown files without good alt text, without
+captioning anything, so it doesn't need a key. Exits with status 1 if
+anything is found at or above --fail-on.
+
+Options:
+`
+
+	failOnHelp = "Specify the least severe finding that fails the audit: note, warning or error"
+	maxAltHelp = "Specify the most characters an alt should have"
+
+	failOnDefault = "error"
+	maxAltDefault = 150
+)
+
+// AuditOptions are the options of the audit subcommand.
+type AuditOptions struct {
+	Files        []string
+	FailOn       string
+	MaxAltLength int
+	Silent       bool
+}
+
+// AuditCli parses the arguments after "gocaption audit".
+func AuditCli(args []string) *AuditOptions {
+	opts := AuditOptions{}
+
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), auditUsage)
+		flags.PrintDefaults()
+	}
+
+	var configFile string
+
+	flags.StringVar(&configFile, "config", configDefault, configHelp)
+	flags.StringVar(&opts.FailOn, "fail-on", failOnDefault, failOnHelp)
+	flags.IntVar(&opts.MaxAltLength, "max-alt-length", maxAltDefault, maxAltHelp)
+	flags.BoolVar(&opts.Silent, "silent", silentDefault, silentHelp)
+	flags.BoolVar(&opts.Silent, "s", silentDefault, shorthandHelp(silentHelp))
+
+	flags.Parse(args)
+
+	// only the config file's file types matter here
+	registerFileTypes(parseConfig(util.ExpandUserDirectory(configFile)).Types)
+
+	opts.Files = argsToFiles(flags.Args(), util.NewStringSet([]string{"html", "xhtml", "markdown"}))
+
+	return &opts
+}
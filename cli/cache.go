@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samuelstevens/gocaption/util"
+)
+
+const (
+	cacheUsage = `Usage: gocaption cache <command> [options] [hash or image...]
+       gocaption cache migrate [options] <cache file>
+
+Commands:
+  list        list cached captions
+  inspect     show everything cached for the given hashes or images
+  invalidate  remove matching captions so they are made again
+  prune       remove captions of local images that no longer exist
+  migrate     copy every caption into another cache file, like a .db file
+
+Options:
+`
+
+	patternHelp   = "Only match images whose path, URL or name matches a glob (end with / to match a directory)"
+	olderThanHelp = "Only match captions older than a duration like 72h or 30d"
+	onlyProvHelp  = "Only match captions from a provider (unknown for captions from before providers were recorded)"
+	allHelp       = "Let invalidate remove every caption"
+)
+
+// CacheOptions are the options of the cache subcommand.
+type CacheOptions struct {
+	Command   string
+	CacheFile string
+	Pattern   string
+	OlderThan time.Duration
+	Provider  string
+	All       bool
+	Args      []string
+}
+
+// parseAge parses a duration, which can also be a number of days like "30d".
+func parseAge(age string) (time.Duration, error) {
+	if strings.HasSuffix(age, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(age, "d"), 64)
+
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", age)
+		}
+
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+
+	return time.ParseDuration(age)
+}
+
+// CacheCli parses the arguments after "gocaption cache".
+func CacheCli(args []string) *CacheOptions {
+	opts := CacheOptions{}
+
+	flags := flag.NewFlagSet("cache", flag.ExitOnError)
+
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), cacheUsage)
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&opts.CacheFile, "cache", cacheDefault, cacheHelp)
+	flags.StringVar(&opts.Pattern, "pattern", "", patternHelp)
+	flags.StringVar(&opts.Provider, "provider", "", onlyProvHelp)
+	flags.BoolVar(&opts.All, "all", false, allHelp)
+
+	var olderThan string
+
+	flags.StringVar(&olderThan, "older-than", "", olderThanHelp)
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	opts.Command = args[0]
+
+	flags.Parse(args[1:])
+
+	if olderThan != "" {
+		age, err := parseAge(olderThan)
+
+		if err != nil {
+			fmt.Fprintf(flags.Output(), "invalid value %q for flag -older-than: %s\n", olderThan, err.Error())
+			os.Exit(2)
+		}
+
+		opts.OlderThan = age
+	}
+
+	opts.CacheFile = util.ExpandUserDirectory(opts.CacheFile)
+	opts.Args = flags.Args()
+
+	return &opts
+}
@@ -9,22 +9,57 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/samuelstevens/gocaption/filetype"
 	"github.com/samuelstevens/gocaption/util"
 )
 
 const (
 	writeHelp     = "Writes any captions found in original .html documents."
+	diffHelp      = "Prints a unified diff of what --write would change"
+	checkHelp     = "Exits with status 1 if any image would gain or change an alt"
 	silentHelp    = "Doesn't report any captions to stdout"
 	thresholdHelp = "Specifies a minimum confidence threshold."
 	configHelp    = "Specify a config file for API keys."
-	cacheHelp     = "Specify a json file to cache captions"
-	fileTypesHelp = "Specify a comma-separated list of file types to label"
+	cacheHelp     = "Specify a json file, or a .db file for SQLite, to cache captions"
+	fileTypesHelp = "Specify a comma-separated list of extensions (md) or file types (image, html, xhtml, markdown) to label"
 	apiKeyHelp    = "Specify an API key for MS Azure"
 	endpointHelp  = "Specfiy an endpoint for MS Azure"
+	localKeyHelp  = "Specify an API key for an openai server"
+	localURLHelp  = "Specify the base URL of an openai or ollama server"
 	loudHelp      = "Writes to stdout when getting a new description"
+	providerHelp  = "Specify a captioning provider: azure, openai (any OpenAI-compatible server), ollama or fake (for tests)"
+	jobsHelp      = "Specify how many images to caption concurrently"
+	rpsHelp       = "Specify a maximum number of requests per second (0 for no limit)"
+	rpmHelp       = "Specify a maximum number of requests per minute (0 for no limit; the Azure free tier allows 20)"
+	budgetHelp    = "Specify a maximum number of requests per run (0 for no limit)"
+	retriesHelp   = "Specify how many times to retry a failed request"
+	altPolicyHelp = "Specify which alts to replace: missing-only, empty-only, overwrite or low-quality"
+	allowHostHelp = "Specify a comma-separated list of hosts to download remote images from (* for any)"
+	timeoutHelp   = "Specify how long to wait when downloading a remote image"
+	maxBytesHelp  = "Specify the largest remote image to download, in bytes"
+	siteRootHelp  = "Specify the directory root-relative image paths like /img/a.png resolve against"
+	guessHelp     = "Look for images that can't be found in every parent directory of the page"
+	candidateHelp = "Specify how many captions to ask for per image (all are cached)"
+	templateHelp  = "Specify a Go template that combines the caption with tags, objects, brands, landmarks and text"
+	ocrHelp       = "Read the text in every image with an OCR engine: azure or tesseract"
+	minWordsHelp  = "Specify how many words of text make an image text-heavy"
+	ocrLengthHelp = "Specify the most characters of text to put in a text-heavy image's alt"
+	languageHelp  = "Specify the language of captions for pages without <html lang> (like es or ja)"
+	fallbackHelp  = "Caption images on pages in languages the provider can't describe in --language instead of leaving them alone"
+	modelHelp     = "Specify the vision model of an openai or ollama server"
+	promptHelp    = "Specify a Go template of the prompt asking an openai or ollama model for alt text"
+	maxLengthHelp = "Specify the most characters of alt text an openai or ollama model writes"
+	fixturesHelp  = "Specify a json file of hashes or file names to captions for the fake provider"
+	recordHelp    = "Record every description to a cassette file"
+	replayHelp    = "Replay descriptions from a cassette file instead of calling the provider"
+	lowConfHelp   = "Specify what to do with captions below the threshold: prefix, skip, placeholder or queue (for gocaption review)"
+	formatHelp    = "Specify how to report what happened to every image: text, json, ndjson, csv, sarif or junit"
 
 	writeDefault     = false
+	diffDefault      = false
+	checkDefault     = false
 	silentDefault    = false
 	thresholdDefault = 0.7
 	configDefault    = "~/.labelrc.json"
@@ -33,24 +68,201 @@ const (
 	apiKeyDefault    = ""
 	endpointDefault  = ""
 	loudDefault      = false
+	providerDefault  = ""
+	jobsDefault      = 4
+	rpsDefault       = 0.0
+	rpmDefault       = 0.0
+	budgetDefault    = 0
+	retriesDefault   = 3
+	altPolicyDefault = "missing-only"
+	allowHostDefault = ""
+	timeoutDefault   = 10 * time.Second
+	maxBytesDefault  = 4 << 20
+	siteRootDefault  = ""
+	guessDefault     = false
+	candidateDefault = 1
+	templateDefault  = ""
+	ocrDefault       = ""
+	minWordsDefault  = 8
+	ocrLengthDefault = 150
+	languageDefault  = ""
+	fallbackDefault  = false
+	lowConfDefault   = "queue"
+	modelDefault     = ""
+	promptDefault    = ""
+	maxLengthDefault = 150
+	fixturesDefault  = ""
+	recordDefault    = ""
+	replayDefault    = ""
+	formatDefault    = "text"
+
+	// dirConfigName is a per-directory config file for the files in its
+	// directory and every directory below it.
+	dirConfigName = ".gocaption.json"
 )
 
 type Options struct {
-	Write      bool
-	Silent     bool
-	Files      []string
-	ConfigFile string
-	CacheFile  string
-	Endpoint   string
-	APIKey     string
-	Threshold  float64
-	Loud       bool
+	Write         bool
+	Diff          bool
+	Check         bool
+	Silent        bool
+	Files         []string
+	ConfigFile    string
+	CacheFile     string
+	Endpoint      string
+	APIKey        string
+	Threshold     float64
+	Loud          bool
+	Provider      string
+	Jobs          int
+	PerSecond     float64
+	PerMinute     float64
+	Budget        int
+	Retries       int
+	AltPolicy     string
+	AllowedHosts  []string
+	FetchTimeout  time.Duration
+	MaxImageBytes int64
+	SiteRoot      string
+	GuessPaths    bool
+	Candidates    int
+	Template      string
+	OCR           string
+	MinWords      int
+	OCRLength     int
+	Language      string
+	// FallbackLanguage captions images in Language when the provider can't
+	// describe images in their page's language.
+	FallbackLanguage bool
+	LowConfidence    string
+	Model            string
+	Prompt           string
+	MaxLength        int
+	Fixtures         string
+	Record           string
+	Replay           string
+	// LocalEndpoint and LocalKey are the endpoint and key of the openai and
+	// ollama providers, kept apart from Azure's.
+	LocalEndpoint string
+	LocalKey      string
+	// Format is how to report the run, like "json".
+	Format string
+	// LowConfidencePrefix and LowConfidencePlaceholder are templates for the
+	// prefix and placeholder low-confidence policies.
+	LowConfidencePrefix      string
+	LowConfidencePlaceholder string
+	// LanguageFlag is true if --language was given, so that it beats
+	// per-directory config files.
+	LanguageFlag bool
 }
 
 type ConfigFile struct {
-	Endpoint  string  `json:"endpoint"`
-	APIKey    string  `json:"key"`
-	Threshold float64 `json:"threshold"`
+	Endpoint  string   `json:"endpoint"`
+	APIKey    string   `json:"key"`
+	Threshold *float64 `json:"threshold"`
+	Provider  string   `json:"provider"`
+	PerSecond *float64 `json:"rps"`
+	PerMinute *float64 `json:"rpm"`
+	Budget    int      `json:"budget"`
+	Retries   int      `json:"retries"`
+	AltPolicy string   `json:"alt_policy"`
+	// AllowedHosts lists hosts remote images can be downloaded from.
+	AllowedHosts []string `json:"allowed_hosts"`
+	SiteRoot     string   `json:"site_root"`
+	GuessPaths   bool     `json:"guess_paths"`
+	Candidates   int      `json:"candidates"`
+	Template     string   `json:"template"`
+	OCR          string   `json:"ocr"`
+	MinWords     int      `json:"ocr_min_words"`
+	OCRLength    int      `json:"ocr_length"`
+	Language     string   `json:"language"`
+	// FallbackLanguage is like --fallback-language.
+	FallbackLanguage bool `json:"fallback_language"`
+	// LowConfidence is a policy like "queue"; LowConfidencePrefix and
+	// LowConfidencePlaceholder are templates for the prefix and placeholder
+	// policies.
+	LowConfidence            string `json:"low_confidence"`
+	LowConfidencePrefix      string `json:"low_confidence_prefix"`
+	LowConfidencePlaceholder string `json:"low_confidence_placeholder"`
+	// Model, Prompt, MaxLength, LocalEndpoint and LocalKey configure the
+	// openai and ollama providers, so Azure's endpoint and key are never
+	// sent to them.
+	LocalEndpoint string `json:"local_endpoint"`
+	LocalKey      string `json:"local_key"`
+	Model         string `json:"model"`
+	Prompt        string `json:"prompt"`
+	MaxLength     int    `json:"max_length"`
+	// Fixtures configures the fake provider.
+	Fixtures string `json:"fixtures"`
+	// Format is how to report the run, like "json".
+	Format string `json:"format"`
+	// Types maps extensions like ".tmpl" to file types like "html".
+	Types map[string]string `json:"types"`
+}
+
+// DirConfig is a per-directory config file.
+type DirConfig struct {
+	Language string `json:"language"`
+}
+
+var dirConfigs = map[string]*DirConfig{}
+
+// parseDirConfig reads the DirConfig in dir, or returns nil if there isn't one.
+func parseDirConfig(dir string) *DirConfig {
+	if config, ok := dirConfigs[dir]; ok {
+		return config
+	}
+
+	var config *DirConfig
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, dirConfigName))
+
+	if err == nil {
+		config = &DirConfig{}
+
+		if err := json.Unmarshal(contents, config); err != nil {
+			log.Fatalf("Cannot parse %s: %s", filepath.Join(dir, dirConfigName), err.Error())
+		}
+	}
+
+	dirConfigs[dir] = config
+
+	return config
+}
+
+// DirLanguage returns the language set by the nearest per-directory config
+// file above path, or fallback if none set one.
+func DirLanguage(path string, fallback string) string {
+	dir, err := filepath.Abs(filepath.Dir(path))
+
+	if err != nil {
+		return fallback
+	}
+
+	for {
+		if config := parseDirConfig(dir); config != nil && config.Language != "" {
+			return config.Language
+		}
+
+		parent := filepath.Dir(dir)
+
+		if parent == dir {
+			return fallback
+		}
+
+		dir = parent
+	}
+}
+
+// PathLanguage returns what to caption the images of a file in: --language
+// if it was given, otherwise the DirLanguage of path, falling back to the
+// config file's language.
+func PathLanguage(path string, opts *Options) string {
+	if opts.LanguageFlag {
+		return opts.Language
+	}
+
+	return DirLanguage(path, opts.Language)
 }
 
 func shorthandHelp(help string) string {
@@ -75,6 +287,35 @@ func parseConfig(fileName string) *ConfigFile {
 	return &config
 }
 
+// validFileType checks if a path's extension (like "htm") or detected type
+// (like "html") is one of the valid file types.
+func validFileType(path string, validFileTypes *util.StringSet) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	if len(ext) != 0 {
+		ext = ext[1:]
+	}
+
+	if validFileTypes.Contains(ext) {
+		return true
+	}
+
+	return validFileTypes.Contains(filetype.Detect(path).String())
+}
+
+// registerFileTypes adds the config file's extension to file type mapping.
+func registerFileTypes(types map[string]string) {
+	for ext, name := range types {
+		fileType, err := filetype.Parse(name)
+
+		if err != nil {
+			log.Fatalf("Cannot parse config file: %s", err.Error())
+		}
+
+		filetype.Register(ext, fileType)
+	}
+}
+
 func argsToFiles(args []string, validFileTypes *util.StringSet) []string {
 	filepaths := []string{}
 
@@ -97,20 +338,8 @@ func argsToFiles(args []string, validFileTypes *util.StringSet) []string {
 					return nil
 				}
 
-				if validFileTypes.Empty() {
+				if validFileTypes.Empty() || validFileType(nestedPath, validFileTypes) {
 					filepaths = append(filepaths, nestedPath)
-				} else {
-
-					ext := filepath.Ext(nestedPath)
-
-					if len(ext) != 0 {
-						ext = ext[1:]
-					}
-
-					if validFileTypes.Contains(ext) {
-						filepaths = append(filepaths, nestedPath)
-					}
-
 				}
 
 				return nil
@@ -135,11 +364,29 @@ func betterConfigString(configValue string, flagValue string) string {
 	return configValue
 }
 
-func betterConfigFloat(configValue float64, flagValue float64, defaultValue float64) float64 {
+// betterConfigFloat prefers a flag that isn't its default, then the config
+// value if the config file sets one, even to 0, and then the default.
+func betterConfigFloat(configValue *float64, flagValue float64, defaultValue float64) float64 {
 	if flagValue != defaultValue {
 		return flagValue
 	}
 
+	if configValue == nil {
+		return defaultValue
+	}
+
+	return *configValue
+}
+
+func betterConfigInt(configValue int, flagValue int, defaultValue int) int {
+	if flagValue != defaultValue {
+		return flagValue
+	}
+
+	if configValue == 0 {
+		return defaultValue
+	}
+
 	return configValue
 }
 
@@ -149,6 +396,9 @@ func Cli() *Options {
 	flag.BoolVar(&opts.Write, "write", writeDefault, writeHelp)
 	flag.BoolVar(&opts.Write, "w", writeDefault, shorthandHelp(writeHelp))
 
+	flag.BoolVar(&opts.Diff, "diff", diffDefault, diffHelp)
+	flag.BoolVar(&opts.Check, "check", checkDefault, checkHelp)
+
 	flag.BoolVar(&opts.Silent, "silent", silentDefault, silentHelp)
 	flag.BoolVar(&opts.Silent, "s", silentDefault, shorthandHelp(silentHelp))
 	flag.BoolVar(&opts.Silent, "quiet", silentDefault, silentHelp)
@@ -157,6 +407,16 @@ func Cli() *Options {
 	flag.BoolVar(&opts.Loud, "loud", loudDefault, loudHelp)
 	flag.BoolVar(&opts.Loud, "l", loudDefault, shorthandHelp(loudHelp))
 
+	flag.IntVar(&opts.Jobs, "jobs", jobsDefault, jobsHelp)
+	flag.IntVar(&opts.Jobs, "j", jobsDefault, shorthandHelp(jobsHelp))
+
+	flag.Float64Var(&opts.PerSecond, "rps", rpsDefault, rpsHelp)
+	flag.Float64Var(&opts.PerMinute, "rpm", rpmDefault, rpmHelp)
+	flag.IntVar(&opts.Budget, "budget", budgetDefault, budgetHelp)
+	flag.IntVar(&opts.Retries, "retries", retriesDefault, retriesHelp)
+
+	flag.StringVar(&opts.AltPolicy, "alt-policy", "", altPolicyHelp+" (default \""+altPolicyDefault+"\")")
+
 	flag.Float64Var(&opts.Threshold, "threshold", thresholdDefault, thresholdHelp)
 	flag.Float64Var(&opts.Threshold, "t", thresholdDefault, shorthandHelp(thresholdHelp))
 
@@ -170,9 +430,44 @@ func Cli() *Options {
 	flag.StringVar(&opts.Endpoint, "endpoint", endpointDefault, endpointHelp)
 	flag.StringVar(&opts.Endpoint, "e", endpointDefault, shorthandHelp(endpointHelp))
 
+	flag.StringVar(&opts.LocalKey, "local-key", apiKeyDefault, localKeyHelp)
+	flag.StringVar(&opts.LocalEndpoint, "local-endpoint", endpointDefault, localURLHelp)
+
+	flag.StringVar(&opts.Provider, "provider", providerDefault, providerHelp)
+	flag.StringVar(&opts.Provider, "p", providerDefault, shorthandHelp(providerHelp))
+
+	flag.StringVar(&opts.Model, "model", modelDefault, modelHelp)
+	flag.StringVar(&opts.Prompt, "prompt", promptDefault, promptHelp)
+	flag.IntVar(&opts.MaxLength, "max-length", maxLengthDefault, maxLengthHelp)
+
+	flag.StringVar(&opts.Fixtures, "fixtures", fixturesDefault, fixturesHelp)
+	flag.StringVar(&opts.Record, "record", recordDefault, recordHelp)
+	flag.StringVar(&opts.Replay, "replay", replayDefault, replayHelp)
+
 	flag.StringVar(&opts.CacheFile, "cache", cacheDefault, cacheHelp)
 	opts.CacheFile = util.ExpandUserDirectory(opts.CacheFile)
 
+	var allowHostsFlag string
+
+	flag.StringVar(&allowHostsFlag, "allow-hosts", allowHostDefault, allowHostHelp)
+	flag.DurationVar(&opts.FetchTimeout, "fetch-timeout", timeoutDefault, timeoutHelp)
+	flag.Int64Var(&opts.MaxImageBytes, "max-image-bytes", maxBytesDefault, maxBytesHelp)
+
+	flag.StringVar(&opts.SiteRoot, "site-root", siteRootDefault, siteRootHelp)
+	flag.BoolVar(&opts.GuessPaths, "guess-paths", guessDefault, guessHelp)
+
+	flag.IntVar(&opts.Candidates, "candidates", candidateDefault, candidateHelp)
+	flag.StringVar(&opts.Template, "template", templateDefault, templateHelp)
+
+	flag.StringVar(&opts.OCR, "ocr", ocrDefault, ocrHelp)
+	flag.IntVar(&opts.MinWords, "ocr-min-words", minWordsDefault, minWordsHelp)
+	flag.IntVar(&opts.OCRLength, "ocr-length", ocrLengthDefault, ocrLengthHelp)
+
+	flag.StringVar(&opts.Language, "language", languageDefault, languageHelp)
+	flag.BoolVar(&opts.FallbackLanguage, "fallback-language", fallbackDefault, fallbackHelp)
+	flag.StringVar(&opts.LowConfidence, "low-confidence", "", lowConfHelp+" (default \""+lowConfDefault+"\")")
+	flag.StringVar(&opts.Format, "format", "", formatHelp+" (default \""+formatDefault+"\")")
+
 	var fileTypesFlag string
 
 	flag.StringVar(&fileTypesFlag, "filetypes", fileTypesDefault, fileTypesHelp)
@@ -180,18 +475,57 @@ func Cli() *Options {
 
 	flag.Parse()
 
-	fileTypes := util.NewStringSet(strings.Split(fileTypesFlag, ","))
+	fileTypes := util.NewStringSet(strings.Split(strings.ToLower(fileTypesFlag), ","))
 
 	fileTypes.Remove("") // in case the flag was empty
 
 	args := flag.Args()
 
-	opts.Files = argsToFiles(args, fileTypes)
 	config := parseConfig(opts.ConfigFile)
+	registerFileTypes(config.Types)
 
+	opts.Files = argsToFiles(args, fileTypes)
+
+	// --key and --endpoint are for whichever provider is used
+	opts.LocalKey = betterConfigString(config.LocalKey, opts.LocalKey)
+	opts.LocalEndpoint = betterConfigString(config.LocalEndpoint, opts.LocalEndpoint)
 	opts.APIKey = betterConfigString(config.APIKey, opts.APIKey)
 	opts.Endpoint = betterConfigString(config.Endpoint, opts.Endpoint)
+	opts.Provider = betterConfigString(config.Provider, opts.Provider)
+	opts.Model = betterConfigString(config.Model, opts.Model)
+	opts.Prompt = betterConfigString(config.Prompt, opts.Prompt)
+	opts.MaxLength = betterConfigInt(config.MaxLength, opts.MaxLength, maxLengthDefault)
+	opts.Fixtures = util.ExpandUserDirectory(betterConfigString(config.Fixtures, opts.Fixtures))
+	opts.Record = util.ExpandUserDirectory(opts.Record)
+	opts.Replay = util.ExpandUserDirectory(opts.Replay)
+
+	opts.SiteRoot = util.ExpandUserDirectory(betterConfigString(config.SiteRoot, opts.SiteRoot))
+	opts.GuessPaths = opts.GuessPaths || config.GuessPaths
+	opts.Candidates = betterConfigInt(config.Candidates, opts.Candidates, candidateDefault)
+	opts.Template = betterConfigString(config.Template, opts.Template)
+	opts.OCR = betterConfigString(config.OCR, opts.OCR)
+	opts.LanguageFlag = opts.Language != ""
+	opts.Language = betterConfigString(config.Language, opts.Language)
+	opts.FallbackLanguage = opts.FallbackLanguage || config.FallbackLanguage
+	opts.MinWords = betterConfigInt(config.MinWords, opts.MinWords, minWordsDefault)
+	opts.OCRLength = betterConfigInt(config.OCRLength, opts.OCRLength, ocrLengthDefault)
+
+	opts.AllowedHosts = config.AllowedHosts
+
+	if allowHostsFlag != "" {
+		opts.AllowedHosts = strings.Split(allowHostsFlag, ",")
+	}
+
+	opts.AltPolicy = betterConfigString(betterConfigString(altPolicyDefault, config.AltPolicy), opts.AltPolicy)
 	opts.Threshold = betterConfigFloat(config.Threshold, opts.Threshold, thresholdDefault)
+	opts.LowConfidence = betterConfigString(betterConfigString(lowConfDefault, config.LowConfidence), opts.LowConfidence)
+	opts.Format = betterConfigString(betterConfigString(formatDefault, config.Format), opts.Format)
+	opts.LowConfidencePrefix = config.LowConfidencePrefix
+	opts.LowConfidencePlaceholder = config.LowConfidencePlaceholder
+	opts.PerSecond = betterConfigFloat(config.PerSecond, opts.PerSecond, rpsDefault)
+	opts.PerMinute = betterConfigFloat(config.PerMinute, opts.PerMinute, rpmDefault)
+	opts.Budget = betterConfigInt(config.Budget, opts.Budget, budgetDefault)
+	opts.Retries = betterConfigInt(config.Retries, opts.Retries, retriesDefault)
 
 	return &opts
 }
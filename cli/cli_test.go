@@ -1,6 +1,14 @@
 package cli
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samuelstevens/gocaption/util"
+)
 
 const (
 	something = "something"
@@ -44,3 +52,122 @@ func TestBetterConfigValue(t *testing.T) {
 		}
 	}
 }
+
+func TestBetterConfigFloat(t *testing.T) {
+	zero, half := 0.0, 0.5
+
+	cases := []struct {
+		config *float64
+		flag   float64
+		want   float64
+	}{
+		{config: nil, flag: 0.7, want: 0.7},
+		{config: &zero, flag: 0.7, want: 0},
+		{config: &half, flag: 0.7, want: 0.5},
+		{config: &half, flag: 0.9, want: 0.9},
+	}
+
+	for _, c := range cases {
+		if got := betterConfigFloat(c.config, c.flag, 0.7); got != c.want {
+			t.Errorf("betterConfigFloat(%v, %f) = %f; wanted %f", c.config, c.flag, got, c.want)
+		}
+	}
+}
+
+func TestValidFileType(t *testing.T) {
+	cases := []struct {
+		path  string
+		types []string
+		want  bool
+	}{
+		{path: "index.htm", types: []string{"html"}, want: true},
+		{path: "index.HTM", types: []string{"htm"}, want: true},
+		{path: "README.md", types: []string{"markdown"}, want: true},
+		{path: "README.md", types: []string{"html"}, want: false},
+		{path: "page.xhtml", types: []string{"html", "xhtml"}, want: true},
+	}
+
+	for _, c := range cases {
+		got := validFileType(c.path, util.NewStringSet(c.types))
+
+		if got != c.want {
+			t.Errorf("validFileType(%s, %v) = %t; wanted %t", c.path, c.types, got, c.want)
+		}
+	}
+}
+
+func TestDirLanguage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, sub := range []string{"es/blog", "ja", "en"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configs := map[string]string{
+		"es": `{"language": "es"}`,
+		"ja": `{"language": "ja"}`,
+		"en": `{}`,
+	}
+
+	for sub, contents := range configs {
+		if err := ioutil.WriteFile(filepath.Join(dir, sub, dirConfigName), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"es/blog/post.html", "es"},
+		{"ja/index.html", "ja"},
+		{"en/index.html", "pt"},
+		{"index.html", "pt"},
+	}
+
+	for _, c := range cases {
+		if got := DirLanguage(filepath.Join(dir, c.path), "pt"); got != c.want {
+			t.Errorf("DirLanguage(%s) == %q, want %q", c.path, got, c.want)
+		}
+	}
+	post := filepath.Join(dir, "es", "blog", "post.html")
+
+	// --language beats per-directory config files, but the config file doesn't
+	if got := PathLanguage(post, &Options{Language: "pt", LanguageFlag: true}); got != "pt" {
+		t.Errorf("PathLanguage with --language pt == %q, want pt", got)
+	}
+
+	if got := PathLanguage(post, &Options{Language: "pt"}); got != "es" {
+		t.Errorf("PathLanguage with a configured language == %q, want es", got)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	cases := []struct {
+		age  string
+		want time.Duration
+		ok   bool
+	}{
+		{"72h", 72 * time.Hour, true},
+		{"30d", 30 * 24 * time.Hour, true},
+		{"1.5d", 36 * time.Hour, true},
+		{"xd", 0, false},
+		{"30", 0, false},
+	}
+
+	for _, c := range cases {
+		got, err := parseAge(c.age)
+
+		if c.ok != (err == nil) || got != c.want {
+			t.Errorf("parseAge(%q) == %s, %v; want %s", c.age, got, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/samuelstevens/gocaption/util"
+)
+
+const reviewUsage = `Usage: gocaption review [options]
+
+Walks through the captions that weren't confident enough to put in a page.
+For each one, accept it, pick another candidate, edit it or reject it.
+Accepted captions are used from then on and never made again.
+
+Options:
+`
+
+// ReviewOptions are the options of the review subcommand.
+type ReviewOptions struct {
+	CacheFile string
+	Pattern   string
+}
+
+// ReviewCli parses the arguments after "gocaption review".
+func ReviewCli(args []string) *ReviewOptions {
+	opts := ReviewOptions{}
+
+	flags := flag.NewFlagSet("review", flag.ExitOnError)
+
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), reviewUsage)
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&opts.CacheFile, "cache", cacheDefault, cacheHelp)
+	flags.StringVar(&opts.Pattern, "pattern", "", patternHelp)
+
+	flags.Parse(args)
+
+	opts.CacheFile = util.ExpandUserDirectory(opts.CacheFile)
+
+	return &opts
+}
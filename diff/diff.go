@@ -0,0 +1,205 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// context is how many unchanged lines surround each change in a hunk.
+const context = 3
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+// op is a single line of an edit script. a and b are the line's position in
+// the old and new text.
+type op struct {
+	kind opKind
+	text string
+	a, b int
+}
+
+// Unified returns a unified diff between two texts, or "" if they are the same.
+func Unified(fromName string, toName string, from string, to string) string {
+	if from == to {
+		return ""
+	}
+
+	ops := edits(splitLines(from), splitLines(to))
+
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "--- %s\n+++ %s\n", fromName, toName)
+
+	for _, hunk := range hunks(ops) {
+		writeHunk(&builder, ops[hunk[0]:hunk[1]])
+	}
+
+	return builder.String()
+}
+
+// splitLines splits text into lines, keeping each line's "\n".
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// edits finds the shortest edit script from a to b with Myers' algorithm.
+func edits(a []string, b []string) []op {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+
+	v := make([]int, 2*max+2)
+	trace := [][]int{}
+
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// walk back through the trace to recover the script
+	reversed := []op{}
+	x, y := n, m
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, op{opEqual, a[x], x, y})
+		}
+
+		if d == 0 {
+			break
+		}
+
+		if x == prevX {
+			y--
+			reversed = append(reversed, op{opInsert, b[y], x, y})
+		} else {
+			x--
+			reversed = append(reversed, op{opDelete, a[x], x, y})
+		}
+	}
+
+	ops := make([]op, len(reversed))
+
+	for i, o := range reversed {
+		ops[len(reversed)-1-i] = o
+	}
+
+	return ops
+}
+
+// hunks groups changes in ops into [start, end) ranges with surrounding context.
+func hunks(ops []op) [][2]int {
+	ranges := [][2]int{}
+
+	for i, o := range ops {
+		if o.kind == opEqual {
+			continue
+		}
+
+		start, end := i-context, i+context+1
+
+		if start < 0 {
+			start = 0
+		}
+
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		if len(ranges) > 0 && start <= ranges[len(ranges)-1][1] {
+			ranges[len(ranges)-1][1] = end
+		} else {
+			ranges = append(ranges, [2]int{start, end})
+		}
+	}
+
+	return ranges
+}
+
+func writeHunk(builder *strings.Builder, ops []op) {
+	fromLen, toLen := 0, 0
+
+	for _, o := range ops {
+		if o.kind != opInsert {
+			fromLen++
+		}
+
+		if o.kind != opDelete {
+			toLen++
+		}
+	}
+
+	fmt.Fprintf(builder, "@@ -%s +%s @@\n", hunkRange(ops[0].a, fromLen), hunkRange(ops[0].b, toLen))
+
+	for _, o := range ops {
+		builder.WriteByte(byte(o.kind))
+		builder.WriteString(o.text)
+
+		if !strings.HasSuffix(o.text, "\n") {
+			builder.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats a 0-based start line and length as in a hunk header.
+func hunkRange(start int, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, length)
+	}
+}
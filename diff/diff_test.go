@@ -0,0 +1,42 @@
+package diff
+
+import "testing"
+
+func TestUnified(t *testing.T) {
+	cases := []struct {
+		from string
+		to   string
+		want string
+	}{
+		{
+			from: "a\nb\n",
+			to:   "a\nb\n",
+			want: "",
+		},
+		{
+			from: "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n",
+			to:   "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl",
+			want: "--- x\n+++ y\n" +
+				"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+				"@@ -9,3 +9,4 @@\n i\n j\n k\n+l\n\\ No newline at end of file\n",
+		},
+		{
+			from: "",
+			to:   "a\n",
+			want: "--- x\n+++ y\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			from: "a\nb\n",
+			to:   "",
+			want: "--- x\n+++ y\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+	}
+
+	for _, c := range cases {
+		got := Unified("x", "y", c.from, c.to)
+
+		if got != c.want {
+			t.Errorf("Unified(%q, %q) = %q; want %q", c.from, c.to, got, c.want)
+		}
+	}
+}
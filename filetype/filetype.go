@@ -0,0 +1,150 @@
+package filetype
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Type is the kind of content in a file.
+type Type int
+
+const (
+	// Unknown files are ignored.
+	Unknown Type = iota
+	// Image files are captioned directly.
+	Image
+	// HTML files have their <img> tags labeled.
+	HTML
+	// XHTML files are HTML files that must stay well-formed XML.
+	XHTML
+	// Markdown files have their images labeled.
+	Markdown
+)
+
+// sniffLen is how much of a file is read to guess its type.
+const sniffLen = 512
+
+var names = map[Type]string{
+	Unknown:  "unknown",
+	Image:    "image",
+	HTML:     "html",
+	XHTML:    "xhtml",
+	Markdown: "markdown",
+}
+
+var (
+	mu         sync.RWMutex
+	extensions = map[string]Type{
+		".jpg":      Image,
+		".jpeg":     Image,
+		".png":      Image,
+		".gif":      Image,
+		".bmp":      Image,
+		".html":     HTML,
+		".htm":      HTML,
+		".shtml":    HTML,
+		".php":      HTML,
+		".xhtml":    XHTML,
+		".xht":      XHTML,
+		".md":       Markdown,
+		".markdown": Markdown,
+		".mdown":    Markdown,
+		".mkd":      Markdown,
+	}
+)
+
+func (t Type) String() string {
+	return names[t]
+}
+
+// Parse parses a type name like "html".
+func Parse(name string) (Type, error) {
+	for t, typeName := range names {
+		if strings.EqualFold(typeName, name) {
+			return t, nil
+		}
+	}
+
+	return Unknown, fmt.Errorf("%q is not a file type", name)
+}
+
+// normalizeExt lower-cases an extension and makes sure it starts with a ".".
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	return ext
+}
+
+// Register maps an extension like ".tmpl" to a Type, replacing any existing
+// mapping.
+func Register(ext string, t Type) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	extensions[normalizeExt(ext)] = t
+}
+
+// FromExtension looks up a path's Type by its (case-insensitive) extension.
+func FromExtension(path string) (Type, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	t, ok := extensions[normalizeExt(filepath.Ext(path))]
+
+	return t, ok
+}
+
+// Detect finds a path's Type from its extension or, failing that, its contents.
+func Detect(path string) Type {
+	if t, ok := FromExtension(path); ok {
+		return t
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return Unknown
+	}
+
+	defer file.Close()
+
+	return Sniff(file)
+}
+
+// Sniff guesses a Type from the start of some content.
+func Sniff(r io.Reader) Type {
+	head := make([]byte, sniffLen)
+
+	n, err := io.ReadFull(r, head)
+
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return Unknown
+	}
+
+	head = head[:n]
+
+	if bytes.Contains(head, []byte("http://www.w3.org/1999/xhtml")) {
+		return XHTML
+	}
+
+	contentType := http.DetectContentType(head)
+
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return Image
+	case strings.HasPrefix(contentType, "text/html"):
+		return HTML
+	default:
+		return Unknown
+	}
+}
@@ -0,0 +1,80 @@
+package filetype
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFromExtension(t *testing.T) {
+	cases := []struct {
+		path string
+		want Type
+		ok   bool
+	}{
+		{path: "index.html", want: HTML, ok: true},
+		{path: "INDEX.HTM", want: HTML, ok: true},
+		{path: "page.shtml", want: HTML, ok: true},
+		{path: "page.xhtml", want: XHTML, ok: true},
+		{path: "README.Md", want: Markdown, ok: true},
+		{path: "cat.JPEG", want: Image, ok: true},
+		{path: "main.go", want: Unknown, ok: false},
+	}
+
+	for _, c := range cases {
+		got, ok := FromExtension(c.path)
+
+		if got != c.want || ok != c.ok {
+			t.Errorf("FromExtension(%s) = %s, %t; want %s, %t", c.path, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("TMPL", HTML)
+	defer Register(".tmpl", Unknown)
+
+	if got := Detect("layout.tmpl"); got != HTML {
+		t.Errorf("Detect(layout.tmpl) = %s; want %s", got, HTML)
+	}
+}
+
+func TestSniff(t *testing.T) {
+	cases := []struct {
+		content string
+		want    Type
+	}{
+		{content: "\x89PNG\x0D\x0A\x1A\x0A", want: Image},
+		{content: "<!DOCTYPE html><p>hi</p>", want: HTML},
+		{content: "<?xml version=\"1.0\"?>\n<html xmlns=\"http://www.w3.org/1999/xhtml\"></html>", want: XHTML},
+		{content: "# Just some text", want: Unknown},
+	}
+
+	for _, c := range cases {
+		if got := Sniff(strings.NewReader(c.content)); got != c.want {
+			t.Errorf("Sniff(%q) = %s; want %s", c.content, got, c.want)
+		}
+	}
+}
+
+func TestDetectSniffsUnknownExtensions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filetype")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "index")
+
+	if err := ioutil.WriteFile(path, []byte("<html><body></body></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := Detect(path); got != HTML {
+		t.Errorf("Detect(%s) = %s; want %s", path, got, HTML)
+	}
+}
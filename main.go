@@ -3,73 +3,305 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"os/signal"
 	"path/filepath"
-	files "path/filepath"
+	"strconv"
 
 	"github.com/samuelstevens/gocaption/api"
 	"github.com/samuelstevens/gocaption/caption"
 	"github.com/samuelstevens/gocaption/cli"
+	"github.com/samuelstevens/gocaption/filetype"
+	md "github.com/samuelstevens/gocaption/markdown"
+	"github.com/samuelstevens/gocaption/report"
+	"github.com/samuelstevens/gocaption/util"
 	"github.com/samuelstevens/gocaption/webpage"
 )
 
-type fileType int
+// document is a file whose images can be captioned, like a *webpage.WebPage.
+type document interface {
+	Path() string
+	Images() ([]webpage.Image, error)
+	Caption(captionFunc webpage.CaptionFunc) error
+	Write() error
+	Diff() string
+	Changes() int
+	Occurrences() []webpage.Occurrence
+}
 
-const (
-	image fileType = iota
-	html
-	unknown
-)
+// messages is where to tell users what is going on; it is stderr when stdout
+// is a report for another program.
+var messages io.Writer = os.Stdout
 
-func getFileType(filepath string) fileType {
-	switch files.Ext(filepath) {
-	case ".jpg", ".png", ".jpeg":
-		return image
-	case ".html", ".htm":
-		return html
-	default:
-		return unknown
+// runReport writes a Record for every image when --format isn't text.
+type runReport struct {
+	writer  report.Writer
+	summary *report.Summary
+}
+
+func newRunReport(format string) (*runReport, error) {
+	if format == report.Text {
+		return nil, nil
+	}
+
+	writer, err := report.New(format, os.Stdout)
+
+	if err != nil {
+		return nil, err
 	}
+
+	return &runReport{writer, report.NewSummary()}, nil
 }
 
-func displayCaption(path string, description string, opts *cli.Options) {
-	if !opts.Silent {
-		fmt.Printf("%s\t%s\n", filepath.Base(path), description)
+// add writes a record. A nil runReport ignores it.
+func (r *runReport) add(record report.Record) {
+	if r == nil {
+		return
+	}
+
+	r.summary.Add(record)
+
+	if err := r.writer.Write(record); err != nil {
+		log.Fatalf("Couldn't write report: %s.\n", err.Error())
 	}
 }
 
-func displayError(path string, err error) {
-	log.Printf("Can't caption %s; %s.\n", filepath.Base(path), err.Error())
+// close writes the summary. A nil runReport does nothing.
+func (r *runReport) close(describer api.Describer) {
+	if r == nil {
+		return
+	}
+
+	if limited, ok := describer.(*api.Limited); ok {
+		r.summary.Requests = limited.Requests()
+		r.summary.Retries = limited.Retries()
+	}
+
+	if err := r.writer.Close(r.summary); err != nil {
+		log.Fatalf("Couldn't write report: %s.\n", err.Error())
+	}
 }
 
-func captionHTML(filepath string, opts *cli.Options, client *api.Client) {
+func newDocument(filepath string, policy webpage.AltPolicy, resolver *caption.Resolver, language string) (document, error) {
+	if filetype.Detect(filepath) == filetype.Markdown {
+		doc, err := md.New(filepath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		doc.Policy = policy
+		doc.Resolver = resolver
+		doc.Language = language
+
+		return doc, nil
+	}
+
 	page, err := webpage.New(filepath)
 
 	if err != nil {
-		displayError(filepath, err)
+		return nil, err
+	}
+
+	page.Policy = policy
+	page.Resolver = resolver
+	page.Language = language
+
+	return page, nil
+}
+
+func displayCaption(path string, c *caption.Caption, opts *cli.Options) {
+	if opts.Silent || opts.Format != report.Text {
 		return
 	}
 
-	err = page.LabelImages(client)
+	switch {
+	case c.Status == caption.Pending:
+		fmt.Printf("%s\t(waiting for review)\n", filepath.Base(path))
+	case c.Status == caption.Rejected:
+		fmt.Printf("%s\t(rejected in review)\n", filepath.Base(path))
+	case c.LowConfidence == caption.Skip.String() && c.Description == "":
+		fmt.Printf("%s\t(skipped; not confident enough)\n", filepath.Base(path))
+	default:
+		fmt.Printf("%s\t%s\n", filepath.Base(path), c.Description)
+	}
+}
+
+func displayError(path string, err error) {
+	log.Printf("Can't caption %s; %s.\n", filepath.Base(path), err.Error())
+}
+
+// captionRequests captions every request and keys the results like
+// caption.Key. With --fallback-language, images in a language the provider
+// can't describe are captioned in the configured language instead.
+func captionRequests(requests []caption.Request, describer api.Describer, opts *cli.Options) map[string]caption.Result {
+	results := map[string]caption.Result{}
+	fallbacks := []caption.Request{}
+	fallbackKeys := []string{}
+	warned := map[string]bool{}
+
+	// no request has a previous alt, so every request for an image gets the
+	// same result
+	for i, result := range caption.NewBatch(requests, describer, opts.Jobs) {
+		request := requests[i]
+		key := caption.Key(request.Source.Name(), request.Language)
+
+		var languageErr *api.LanguageError
+
+		if opts.FallbackLanguage && errors.As(result.Err, &languageErr) && request.Language != opts.Language {
+			if !warned[request.Language] && !opts.Silent {
+				warned[request.Language] = true
+				fmt.Fprintf(messages, "%s; captioning those images in %s instead.\n", languageErr.Error(), languageName(opts.Language))
+			}
+
+			fallbacks = append(fallbacks, caption.Request{Source: request.Source, Language: opts.Language})
+			fallbackKeys = append(fallbackKeys, key)
+			continue
+		}
+
+		results[key] = result
+	}
+
+	for i, result := range caption.NewBatch(fallbacks, describer, opts.Jobs) {
+		results[fallbackKeys[i]] = result
+	}
+
+	return results
+}
+
+// languageName names a language for messages.
+func languageName(language string) string {
+	if language == "" {
+		return "the default language"
+	}
+
+	return language
+}
+
+// captionDocument labels a document and returns how many of its images would gain or change an alt.
+func captionDocument(doc document, results map[string]caption.Result, opts *cli.Options, describer api.Describer, run *runReport) int {
+	captions := []*caption.Caption{}
+
+	err := doc.Caption(func(source caption.Source, prevDescription string, language string) (*caption.Caption, error) {
+		result, ok := results[caption.Key(source.Name(), language)]
+
+		if !ok {
+			result.Caption, result.Err = caption.New(source, prevDescription, language, describer)
+		}
+
+		if result.Err == nil {
+			captions = append(captions, result.Caption)
+		}
+
+		return result.Caption, result.Err
+	})
 
 	if err != nil {
-		displayError(filepath, err)
-		return
+		displayError(doc.Path(), err)
+		run.add(report.Record{Page: doc.Path(), Action: report.Failed, Error: report.ErrorCode(err), Message: err.Error()})
+		return 0
+	}
+
+	for _, occurrence := range doc.Occurrences() {
+		run.add(report.FromOccurrence(doc.Path(), occurrence))
 	}
 
 	if opts.Write {
-		err = page.Write()
+		err = doc.Write()
 		if err != nil {
-			fmt.Printf("Couldn't update file: %s.\n", err.Error())
+			fmt.Fprintf(messages, "Couldn't update file: %s.\n", err.Error())
+		}
+	}
+
+	if opts.Check && doc.Changes() > 0 {
+		fmt.Fprintf(messages, "%s: %d image(s) would gain or change alt text.\n", doc.Path(), doc.Changes())
+	}
+
+	if opts.Diff {
+		fmt.Print(doc.Diff())
+		return doc.Changes()
+	}
+
+	for _, caption := range captions {
+		displayCaption(caption.FilePath, caption, opts)
+	}
+
+	return doc.Changes()
+}
+
+// captionProfile lists everything besides an image and its language that
+// changes its caption, so cached captions made differently aren't reused.
+func captionProfile(config api.Config, opts *cli.Options) caption.Profile {
+	provider := config.Provider
+
+	if provider == "" {
+		provider = api.DefaultProvider
+	}
+
+	options := map[string]string{
+		"threshold": strconv.FormatFloat(config.Threshold, 'g', -1, 64),
+	}
+
+	// one candidate is the default, so it keeps older cached captions
+	if config.Candidates > 1 {
+		options["candidates"] = strconv.Itoa(config.Candidates)
+	}
+
+	if opts.Template != "" {
+		options["template"] = opts.Template
+	}
+
+	if provider != "azure" {
+		prompt := config.Prompt
+
+		if prompt == "" {
+			prompt = api.DefaultPrompt
 		}
+
+		options["prompt"] = prompt
+		options["max_length"] = strconv.Itoa(config.MaxLength)
 	}
 
-	for _, caption := range page.Captions {
-		displayCaption(caption.FilePath, caption.Description, opts)
+	if config.OCR != "" {
+		options["ocr"] = config.OCR
+		options["ocr_min_words"] = strconv.Itoa(config.MinWords)
+		options["ocr_length"] = strconv.Itoa(opts.OCRLength)
 	}
+
+	return caption.Profile{Provider: provider, Model: api.Model(config), Options: options}
+}
+
+// closeCacheOnInterrupt saves any pending captions if the user hits Ctrl-C.
+func closeCacheOnInterrupt() {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+
+	go func() {
+		<-interrupts
+
+		if err := caption.CloseCache(); err != nil {
+			log.Printf("Couldn't save caption cache: %s.\n", err.Error())
+		}
+
+		os.Exit(130)
+	}()
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		os.Exit(cacheCommand(cli.CacheCli(os.Args[2:])))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "review" {
+		os.Exit(reviewCommand(cli.ReviewCli(os.Args[2:])))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		os.Exit(auditCommand(cli.AuditCli(os.Args[2:])))
+	}
+
 	opts := cli.Cli()
 
 	if len(opts.Files) == 0 {
@@ -77,39 +309,217 @@ func main() {
 		return
 	}
 
-	caption.InitializeCache(opts.CacheFile)
+	run, err := newRunReport(opts.Format)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	if run != nil {
+		if opts.Diff {
+			log.Fatalf("--diff can't be combined with --format %s", opts.Format)
+		}
+
+		messages = os.Stderr
+	}
+
+	policy, err := webpage.ParseAltPolicy(opts.AltPolicy)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	err = caption.InitializeCache(opts.CacheFile)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	closeCacheOnInterrupt()
+
+	err = caption.SetTemplate(opts.Template)
+
+	if err != nil {
+		log.Fatalf("Can't parse --template: %s", err.Error())
+	}
+
+	caption.SetTextLength(opts.OCRLength)
+
+	lowConfidence, err := caption.ParseLowConfidence(opts.LowConfidence)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	err = caption.SetLowConfidence(lowConfidence, opts.LowConfidencePrefix, opts.LowConfidencePlaceholder)
+
+	if err != nil {
+		log.Fatalf("Can't parse low_confidence_prefix or low_confidence_placeholder: %s", err.Error())
+	}
+
+	config := api.Config{
+		Provider:      opts.Provider,
+		Key:           opts.APIKey,
+		Endpoint:      opts.Endpoint,
+		LocalKey:      opts.LocalKey,
+		LocalEndpoint: opts.LocalEndpoint,
+		Threshold:     opts.Threshold,
+		Loud:          opts.Loud,
+		Candidates:    opts.Candidates,
+		Enrich:        opts.Template != "",
+		OCR:           opts.OCR,
+		MinWords:      opts.MinWords,
+		Model:         opts.Model,
+		Prompt:        opts.Prompt,
+		MaxLength:     opts.MaxLength,
+		Fixtures:      opts.Fixtures,
+		Record:        opts.Record,
+		Replay:        opts.Replay,
+		Limits: api.Limits{
+			PerSecond:   opts.PerSecond,
+			PerMinute:   opts.PerMinute,
+			MaxRequests: opts.Budget,
+			MaxRetries:  opts.Retries,
+		},
+	}
 
-	client, err := api.New(opts.APIKey, opts.Endpoint, opts.Threshold, opts.Loud)
+	describer, err := api.New(config)
 
 	if err != nil {
 		if errors.Is(err, api.ErrorAuth) {
 			// provide some help in the form of missing config
 
-			fmt.Println("You need to specify some keys for MS Azure. You can also specify a config file with --config.")
+			fmt.Fprintln(messages, "You need to specify some keys for MS Azure. You can also specify a config file with --config.")
+		}
+
+		if errors.Is(err, api.ErrorModel) {
+			fmt.Fprintln(messages, "You need to specify the server's vision model with --model or \"model\" in your config file.")
 		}
 		log.Fatal(err.Error())
 	}
 
+	caption.SetProfile(captionProfile(config, opts))
+
+	resolver := &caption.Resolver{Guess: opts.GuessPaths}
+
+	if opts.SiteRoot != "" {
+		siteRoot, err := filepath.Abs(opts.SiteRoot)
+
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		resolver.SiteRoot = siteRoot
+	}
+
+	guessed := util.NewStringSet([]string{})
+
+	resolver.OnGuess = func(pagePath string, ref string, guess string) {
+		// pages are read more than once, so only report each guess once
+		key := pagePath + "\x00" + ref
+
+		if !opts.Silent && !guessed.Contains(key) {
+			fmt.Fprintf(messages, "Guessed %s is %s in %s; use --site-root to resolve it exactly.\n", ref, guess, pagePath)
+		}
+
+		(*guessed)[key] = util.Exists
+	}
+
+	if len(opts.AllowedHosts) > 0 {
+		resolver.Fetcher = caption.NewFetcher(opts.AllowedHosts, opts.FetchTimeout, opts.MaxImageBytes)
+	}
+
+	// collect every image up front so they can be captioned concurrently
+	requests := []caption.Request{}
+	docs := map[string]document{}
+
 	for _, filepath := range opts.Files {
-		switch getFileType(filepath) {
-		case image:
-			caption, err := caption.New(filepath, "", client)
+		switch filetype.Detect(filepath) {
+		case filetype.Image:
+			requests = append(requests, caption.Request{
+				Source:   caption.File(filepath),
+				Language: cli.PathLanguage(filepath, opts),
+			})
+
+		case filetype.HTML, filetype.XHTML, filetype.Markdown:
+			doc, err := newDocument(filepath, policy, resolver, cli.PathLanguage(filepath, opts))
 
 			if err != nil {
 				displayError(filepath, err)
+				run.add(report.Record{Page: filepath, Action: report.Failed, Error: report.ErrorCode(err), Message: err.Error()})
 				continue
 			}
 
-			displayCaption(filepath, caption.Description, opts)
+			images, err := doc.Images()
 
-		case html:
-			captionHTML(filepath, opts, client)
+			if err != nil {
+				displayError(filepath, err)
+				run.add(report.Record{Page: filepath, Action: report.Failed, Error: report.ErrorCode(err), Message: err.Error()})
+				continue
+			}
 
-		case unknown:
+			for _, image := range images {
+				requests = append(requests, caption.Request{Source: image.Source, Language: image.Language})
+			}
 
-		default:
-			log.Fatalf("Unreachable code.\n")
+			docs[filepath] = doc
 		}
 	}
 
+	results := captionRequests(requests, describer, opts)
+	changes := 0
+
+	for _, filepath := range opts.Files {
+		switch filetype.Detect(filepath) {
+		case filetype.Image:
+			result := results[caption.Key(filepath, cli.PathLanguage(filepath, opts))]
+			run.add(report.FromCaption(filepath, result.Caption, result.Err))
+
+			if result.Err != nil {
+				displayError(filepath, result.Err)
+				continue
+			}
+
+			displayCaption(filepath, result.Caption, opts)
+
+		case filetype.HTML, filetype.XHTML, filetype.Markdown:
+			doc, ok := docs[filepath]
+
+			if !ok {
+				continue
+			}
+
+			if run != nil {
+				run.summary.Pages++
+			}
+
+			changes += captionDocument(doc, results, opts, describer, run)
+		}
+	}
+
+	pending := 0
+
+	for _, result := range results {
+		if result.Err == nil && result.Caption.Status == caption.Pending {
+			pending++
+		}
+	}
+
+	if pending > 0 && !opts.Silent {
+		fmt.Fprintf(messages, "%d image(s) weren't captioned confidently and are waiting for review; run gocaption review.\n", pending)
+	}
+
+	if limited, ok := describer.(*api.Limited); ok && opts.Loud {
+		fmt.Fprintf(messages, "Made %d requests (%d retries).\n", limited.Requests(), limited.Retries())
+	}
+
+	run.close(describer)
+
+	if err := caption.CloseCache(); err != nil {
+		log.Fatalf("Couldn't save caption cache: %s.\n", err.Error())
+	}
+
+	if opts.Check && changes > 0 {
+		os.Exit(1)
+	}
 }
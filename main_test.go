@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samuelstevens/gocaption/api"
+	"github.com/samuelstevens/gocaption/caption"
+	"github.com/samuelstevens/gocaption/cli"
+)
+
+// binary is gocaption, built once for every test.
+var binary string
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "gocaption")
+
+	if err != nil {
+		panic(err)
+	}
+
+	binary = filepath.Join(dir, "gocaption")
+
+	if out, err := exec.Command("go", "build", "-o", binary, ".").CombinedOutput(); err != nil {
+		panic(string(out))
+	}
+
+	status := m.Run()
+
+	os.RemoveAll(dir)
+	os.Exit(status)
+}
+
+// setupSite copies testdata/site to a temporary directory, which is also the
+// home directory of every run, so no real config or cache is used.
+func setupSite(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "site")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = filepath.Walk("testdata/site", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, _ := filepath.Rel("testdata", path)
+		dest := filepath.Join(dir, rel)
+
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(dest, data, 0644)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+// run runs gocaption in dir and returns its output and exit status.
+func run(t *testing.T, dir string, args ...string) (string, int) {
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "HOME="+dir)
+
+	out, err := cmd.CombinedOutput()
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(out), exitErr.ExitCode()
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(out), 0
+}
+
+// reportOutput runs gocaption in dir and returns only its stdout, which is a report
+// with --format.
+func reportOutput(t *testing.T, dir string, args ...string) []byte {
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "HOME="+dir)
+
+	out, err := cmd.Output()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return out
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestCaptionWithFake(t *testing.T) {
+	dir := setupSite(t)
+	defer os.RemoveAll(dir)
+
+	fixtures, _ := filepath.Abs("testdata/fixtures.json")
+
+	out, status := run(t, dir, "--provider", "fake", "--fixtures", fixtures, "--threshold", "0.5", "--site-root", "site", "--filetypes", "html,md", "--write", "site")
+
+	if status != 0 {
+		t.Fatalf("exited with %d: %s", status, out)
+	}
+
+	page := readFile(t, filepath.Join(dir, "site", "index.html"))
+
+	// the chart isn't confident enough to put in the page
+	for _, want := range []string{`<img src="images/black-cat.png" alt="black cat">`, `<img src="images/dog.png" alt="my dog">`, `<img src="/images/chart.png">`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("index.html should contain %s:\n%s", want, page)
+		}
+	}
+
+	if post := readFile(t, filepath.Join(dir, "site", "blog", "post.md")); !strings.Contains(post, "![black cat](../images/black-cat.png)") {
+		t.Errorf("post.md should have a caption:\n%s", post)
+	}
+
+	if !strings.Contains(out, "chart.png\t(waiting for review)") {
+		t.Errorf("the low-confidence chart should wait for review:\n%s", out)
+	}
+
+	out, status = run(t, dir, "cache", "list", "--pattern", "*.png")
+
+	// the cat is captioned in English for the page and without a language for the post
+	if status != 0 || strings.Count(out, "\n") != 3 {
+		t.Errorf("cache list should list 3 captions, exited with %d:\n%s", status, out)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := setupSite(t)
+	defer os.RemoveAll(dir)
+
+	page := filepath.Join("site", "index.html")
+
+	if out, status := run(t, dir, "--provider", "fake", "--check", "--silent", page); status != 1 || !strings.Contains(out, "1 image(s) would gain or change alt text") {
+		t.Errorf("--check exited with %d, want 1:\n%s", status, out)
+	}
+
+	if out, status := run(t, dir, "--provider", "fake", "--site-root", "site", "--write", "--silent", page); status != 0 {
+		t.Fatalf("exited with %d: %s", status, out)
+	}
+
+	if out, status := run(t, dir, "--provider", "fake", "--site-root", "site", "--check", "--silent", page); status != 0 {
+		t.Errorf("--check exited with %d after --write, want 0:\n%s", status, out)
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := setupSite(t)
+	defer os.RemoveAll(dir)
+
+	page := filepath.Join("site", "index.html")
+
+	if out, status := run(t, dir, "--provider", "fake", "--record", "cassette.json", "--cache", "recorded.json", page); status != 0 {
+		t.Fatalf("recording exited with %d: %s", status, out)
+	}
+
+	// replaying as azure needs no key, and a new cache means nothing is reused
+	out, status := run(t, dir, "--provider", "azure", "--replay", "cassette.json", "--cache", "replayed.json", "--diff", page)
+
+	if status != 0 {
+		t.Fatalf("replaying exited with %d: %s", status, out)
+	}
+
+	if !strings.Contains(out, `+	<img src="images/black-cat.png" alt="black cat">`) {
+		t.Errorf("the replayed diff should caption the cat:\n%s", out)
+	}
+
+	out, status = run(t, dir, "--provider", "azure", "--replay", "cassette.json", "--cache", "missing.json", filepath.Join("site", "images", "chart.png"))
+
+	if !strings.Contains(out, "isn't recorded in cassette") {
+		t.Errorf("an image that wasn't recorded should fail, exited with %d:\n%s", status, out)
+	}
+}
+
+func TestJSONReport(t *testing.T) {
+	dir := setupSite(t)
+	defer os.RemoveAll(dir)
+
+	out := reportOutput(t, dir, "--provider", "fake", "--format", "json", "--loud", filepath.Join("site", "index.html"))
+
+	var run struct {
+		Records []struct {
+			Src    string `json:"src"`
+			Action string `json:"action"`
+			Error  string `json:"error"`
+		} `json:"records"`
+		Summary struct {
+			Images int `json:"images"`
+		} `json:"summary"`
+	}
+
+	if err := json.Unmarshal(out, &run); err != nil {
+		t.Fatalf("stdout isn't a json report: %s\n%s", err, out)
+	}
+
+	// the chart is root-relative, and there is no --site-root
+	want := map[string]string{"images/black-cat.png": "added", "images/dog.png": "skipped", "/images/chart.png": "failed"}
+
+	if len(run.Records) != len(want) || run.Summary.Images != len(want) {
+		t.Fatalf("report should have %d records:\n%s", len(want), out)
+	}
+
+	for _, record := range run.Records {
+		if want[record.Src] != record.Action {
+			t.Errorf("%s was %s, want %s", record.Src, record.Action, want[record.Src])
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	dir := setupSite(t)
+	defer os.RemoveAll(dir)
+
+	// no provider or key is needed
+	out, status := run(t, dir, "audit", "site")
+
+	if status != 1 || !strings.Contains(out, "black-cat.png: image has no alt [missing-alt]") {
+		t.Errorf("audit should find the cat's missing alt, exited with %d:\n%s", status, out)
+	}
+
+	if out, status := run(t, dir, "audit", "--fail-on", "error", filepath.Join("site", "images", "dog.png")); status != 0 {
+		t.Errorf("auditing a file that isn't a page should only warn, exited with %d:\n%s", status, out)
+	}
+
+	pages := filepath.Join(dir, "pages")
+
+	if err := os.Mkdir(pages, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(filepath.Join(dir, "missing.md"), filepath.Join(pages, "gone.md")); err != nil {
+		t.Skip("can't make a broken link:", err)
+	}
+
+	if out, status := run(t, dir, "audit", "pages"); status != 1 || !strings.Contains(out, "Couldn't audit 1 file(s).") {
+		t.Errorf("a page that can't be read should fail the audit, exited with %d:\n%s", status, out)
+	}
+}
+
+func TestSARIFReport(t *testing.T) {
+	dir := setupSite(t)
+	defer os.RemoveAll(dir)
+
+	out := string(reportOutput(t, dir, "--provider", "fake", "--format", "sarif", filepath.Join("site", "index.html")))
+
+	// the cat is missing an alt, and the chart can't be resolved
+	for _, want := range []string{`"uri": "site/index.html"`, `"startLine": 7`, `"ruleId": "missing-alt"`, `"ruleId": "caption-failed"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the sarif report should contain %s:\n%s", want, out)
+		}
+	}
+}
+
+// germanlessDescriber can't describe images in German.
+type germanlessDescriber struct{}
+
+func (germanlessDescriber) Describe(name string, image io.Reader, language string) (*api.Description, error) {
+	if language == "de" {
+		return nil, &api.LanguageError{Provider: "test", Language: language}
+	}
+
+	return &api.Description{Candidates: []api.Candidate{{Text: "a cat in " + language, Confidence: 0.9}}}, nil
+}
+
+func TestCaptionRequestsFallsBack(t *testing.T) {
+	dir := setupSite(t)
+	defer os.RemoveAll(dir)
+
+	if err := caption.InitializeCache(filepath.Join(dir, "captions.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	defer caption.CloseCache()
+
+	messages = ioutil.Discard
+	defer func() { messages = os.Stdout }()
+
+	imgPath := filepath.Join(dir, "site", "images", "black-cat.png")
+	requests := []caption.Request{{Source: caption.File(imgPath), Language: "de"}}
+
+	// images in other languages are left alone unless asked for
+	results := captionRequests(requests, germanlessDescriber{}, &cli.Options{Language: "en", Jobs: 1})
+
+	if result := results[caption.Key(imgPath, "de")]; result.Err == nil {
+		t.Errorf("got %+v; want a language error", result)
+	}
+
+	results = captionRequests(requests, germanlessDescriber{}, &cli.Options{Language: "en", FallbackLanguage: true, Jobs: 1})
+	result := results[caption.Key(imgPath, "de")]
+
+	if result.Err != nil || result.Caption.Description != "a cat in en" {
+		t.Errorf("got %+v; want the caption in the configured language", result)
+	}
+}
+
+func TestCaptionProfileCandidates(t *testing.T) {
+	one := captionProfile(api.Config{Provider: "azure", Threshold: 0.7, Candidates: 1}, &cli.Options{})
+	five := captionProfile(api.Config{Provider: "azure", Threshold: 0.7, Candidates: 5}, &cli.Options{})
+
+	if one.ID() == five.ID() {
+		t.Errorf("captions of one and five candidates share the profile %s", one.ID())
+	}
+}
@@ -0,0 +1,12 @@
+package markdown
+
+import "fmt"
+
+// FileTypeError occurs when a Document doesn't get a Markdown file
+type FileTypeError struct {
+	path string
+}
+
+func (e *FileTypeError) Error() string {
+	return fmt.Sprintf("%s is not a Markdown file", e.path)
+}
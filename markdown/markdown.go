@@ -0,0 +1,292 @@
+package markdown
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/samuelstevens/gocaption/api"
+	"github.com/samuelstevens/gocaption/caption"
+	"github.com/samuelstevens/gocaption/diff"
+	"github.com/samuelstevens/gocaption/filetype"
+	"github.com/samuelstevens/gocaption/webpage"
+)
+
+// Document represents a Markdown file whose images will have their alt text
+// updated. Both ![alt](src) images and inline <img> tags are labeled.
+type Document struct {
+	absolutePath string
+	original     string
+	content      string
+	changes      int
+	Captions     []*caption.Caption
+	Policy       webpage.AltPolicy
+	Resolver     *caption.Resolver
+	// Language is what to caption images in.
+	Language    string
+	occurrences []webpage.Occurrence
+}
+
+// New returns a new Document
+func New(path string) (*Document, error) {
+	if filetype.Detect(path) != filetype.Markdown {
+		return nil, &FileTypeError{path}
+	}
+
+	path, err := filepath.Abs(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Document{
+		absolutePath: path,
+		content:      "",
+		Captions:     []*caption.Caption{},
+	}, nil
+}
+
+// Path returns the absolute path of the Document.
+func (d *Document) Path() string {
+	return d.absolutePath
+}
+
+// Write saves the labeled document if anything changed.
+func (d *Document) Write() error {
+	if d.content == d.original {
+		return nil
+	}
+
+	return ioutil.WriteFile(d.absolutePath, []byte(d.content), 0644)
+}
+
+// Diff returns a unified diff of what Write would change.
+func (d *Document) Diff() string {
+	return diff.Unified("a"+d.absolutePath, "b"+d.absolutePath, d.original, d.content)
+}
+
+// Changes returns how many images would gain or change an alt.
+func (d *Document) Changes() int {
+	return d.changes
+}
+
+// Occurrences lists every image in the document, in order, and what the last
+// call to Caption did with it.
+func (d *Document) Occurrences() []webpage.Occurrence {
+	return d.occurrences
+}
+
+// LabelImages takes a Markdown string and returns a new string with labeled
+// images. An empty Markdown alt counts as a missing one, and gocaption
+// comments are honored like in HTML. Only the alt text of each image is
+// changed; every other byte is left as it was.
+func LabelImages(input string, policy webpage.AltPolicy, labelFunc webpage.LabelFunc) (string, error) {
+	return LabelImagesSkipping(input, policy, labelFunc, nil)
+}
+
+// LabelImagesSkipping is like LabelImages, but tells skipFunc about every
+// image it leaves alone. skipFunc may be nil.
+func LabelImagesSkipping(input string, policy webpage.AltPolicy, labelFunc webpage.LabelFunc, skipFunc webpage.SkipFunc) (string, error) {
+	labeled, _, err := labelImages(input, policy, labelFunc, skipFunc)
+
+	return labeled, err
+}
+
+// labelImages is LabelImagesSkipping, but also returns the Position of every
+// image, in the order labelFunc or skipFunc was called for them.
+func labelImages(input string, policy webpage.AltPolicy, labelFunc webpage.LabelFunc, skipFunc webpage.SkipFunc) (string, []webpage.Position, error) {
+	var builder strings.Builder
+
+	last := 0
+	spans := findImages(input)
+	positions := []webpage.Position{}
+	lines := webpage.NewPositions(input)
+	directives := &webpage.Directives{}
+
+	for _, s := range spans {
+		if s.comment != "" {
+			directives.Comment(s.comment)
+			continue
+		}
+
+		builder.WriteString(input[last:s.start])
+		last = s.end
+
+		original := input[s.start:s.end]
+
+		if s.html {
+			positions = append(positions, lines.At(s.start))
+
+			labeled, err := webpage.LabelImagesFollowing(original, directives, policy, labelFunc, skipFunc)
+
+			if err != nil {
+				return "", nil, err
+			}
+
+			builder.WriteString(labeled)
+			continue
+		}
+
+		// the span starts with the alt, so the image starts at its "!["
+		positions = append(positions, lines.At(s.start-2))
+
+		alt := original
+
+		if s.label != "" {
+			alt = s.label
+		}
+
+		if directives.Ignore() {
+			if skipFunc != nil {
+				skipFunc(s.src, alt, webpage.SkipIgnored)
+			}
+
+			builder.WriteString(original)
+			continue
+		}
+
+		if !policy.ShouldLabel(s.src, alt, alt != "") {
+			if skipFunc != nil {
+				skipFunc(s.src, alt, webpage.SkipHasAlt)
+			}
+
+			builder.WriteString(original)
+			continue
+		}
+
+		caption := labelFunc(s.src, alt)
+
+		if caption == "" || escapeAlt(caption) == alt {
+			builder.WriteString(original)
+			continue
+		}
+
+		builder.WriteString(escapeAlt(caption))
+
+		// the alt is also the label, so keep the label to keep the link
+		if s.label != "" {
+			builder.WriteString("][" + s.label)
+		}
+	}
+
+	builder.WriteString(input[last:])
+
+	return builder.String(), positions, nil
+}
+
+func (d *Document) read() (string, error) {
+	file, err := os.Open(d.absolutePath)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	rawDoc, err := ioutil.ReadAll(file)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(rawDoc), nil
+}
+
+// Images lists every image in a Markdown document that the Document's Policy
+// allows labeling and whose source can be resolved.
+func (d *Document) Images() ([]webpage.Image, error) {
+	rawDoc, err := d.read()
+
+	if err != nil {
+		return nil, err
+	}
+
+	images := []webpage.Image{}
+
+	_, err = LabelImages(rawDoc, d.Policy, func(relativeImgPath string, prevDescription string) string {
+		source, err := d.Resolver.Resolve(d.absolutePath, relativeImgPath)
+
+		if err == nil {
+			images = append(images, webpage.Image{Source: source, Description: prevDescription, Language: d.Language})
+		}
+
+		return ""
+	})
+
+	return images, err
+}
+
+// LabelImages takes all the images in a Markdown document and adds alt text
+// if it is missing.
+func (d *Document) LabelImages(describer api.Describer) error {
+	return d.Caption(func(source caption.Source, prevDescription string, language string) (*caption.Caption, error) {
+		return caption.New(source, prevDescription, language, describer)
+	})
+}
+
+// Caption is like LabelImages, but gets each caption from captionFunc.
+func (d *Document) Caption(captionFunc webpage.CaptionFunc) error {
+	rawDoc, err := d.read()
+
+	if err != nil {
+		return err
+	}
+
+	d.changes = 0
+	d.occurrences = []webpage.Occurrence{}
+
+	labelFunc := func(relativeImgPath string, prevDescription string) string {
+		occurrence := webpage.Occurrence{Src: relativeImgPath, PrevDescription: prevDescription}
+
+		defer func() {
+			d.occurrences = append(d.occurrences, occurrence)
+		}()
+
+		source, err := d.Resolver.Resolve(d.absolutePath, relativeImgPath)
+
+		if err != nil {
+			occurrence.Err = err
+			return ""
+		}
+
+		occurrence.Source = source
+
+		// the policy already decided prevDescription should be replaced
+		caption, err := captionFunc(source, "", d.Language)
+
+		if err != nil {
+			occurrence.Err = err
+			return ""
+		}
+
+		occurrence.Caption = caption
+		d.Captions = append(d.Captions, caption)
+
+		if caption.Description != "" && caption.Description != prevDescription {
+			d.changes++
+		}
+
+		return caption.Description
+	}
+
+	skipFunc := func(relativeImgPath string, alt string, reason string) {
+		d.occurrences = append(d.occurrences, webpage.Occurrence{Src: relativeImgPath, PrevDescription: alt, Skipped: reason})
+	}
+
+	updatedDoc, positions, err := labelImages(rawDoc, d.Policy, labelFunc, skipFunc)
+
+	if err != nil {
+		return err
+	}
+
+	// every image gets exactly one occurrence, in document order
+	for i := range d.occurrences {
+		d.occurrences[i].Position = positions[i]
+	}
+
+	d.original = rawDoc
+	d.content = updatedDoc
+
+	return nil
+}
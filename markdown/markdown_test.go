@@ -0,0 +1,175 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/samuelstevens/gocaption/webpage"
+)
+
+func TestLabelImages(t *testing.T) {
+	var labelFunc webpage.LabelFunc = func(imgPath string, prevDescription string) string {
+		if imgPath == "missing.png" {
+			return ""
+		}
+
+		return "a [fat] cat: " + imgPath
+	}
+
+	cases := []struct {
+		markdown string
+		want     string
+	}{
+		{
+			markdown: "# Hello!\n\nNo images *here*.\n",
+			want:     "# Hello!\n\nNo images *here*.\n",
+		},
+		{
+			markdown: "Look: ![](cat.png \"Title\") and ![Whiskers](cat.png).",
+			want:     "Look: ![a \\[fat\\] cat: cat.png](cat.png \"Title\") and ![Whiskers](cat.png).",
+		},
+		{
+			markdown: "![](<my cat.png>)\n![](images/(1).png)\n![](missing.png)",
+			want:     "![a \\[fat\\] cat: my cat.png](<my cat.png>)\n![a \\[fat\\] cat: images/(1).png](images/(1).png)\n![](missing.png)",
+		},
+		{
+			markdown: "![][cat] ![][Big  Cat] ![][]\n\n[cat]: cat.png\n[big cat]: <big cat.png> \"Big\"\n",
+			want:     "![a \\[fat\\] cat: cat.png][cat] ![a \\[fat\\] cat: big cat.png][Big  Cat] ![][]\n\n[cat]: cat.png\n[big cat]: <big cat.png> \"Big\"\n",
+		},
+		{
+			markdown: "Inline <IMG src=\"cat.png\" class='x'> html.",
+			want:     "Inline <IMG src=\"cat.png\" class='x' alt=\"a [fat] cat: cat.png\"> html.",
+		},
+		{
+			markdown: "`![](a.png)` and ``x ` ![](b.png)``\n\n```md\n![](c.png)\n<img src=\"d.png\">\n```\n\n\\![](e.png) <!-- ![](f.png) -->",
+			want:     "`![](a.png)` and ``x ` ![](b.png)``\n\n```md\n![](c.png)\n<img src=\"d.png\">\n```\n\n\\![](e.png) <!-- ![](f.png) -->",
+		},
+		{
+			markdown: "Code:\n\n    ![](a.png)\n\n\t<img src=\"b.png\">\nText\n    ![](c.png)\n\n- item\n\n    ![](d.png)\n",
+			want:     "Code:\n\n    ![](a.png)\n\n\t<img src=\"b.png\">\nText\n    ![a \\[fat\\] cat: c.png](c.png)\n\n- item\n\n    ![a \\[fat\\] cat: d.png](d.png)\n",
+		},
+		{
+			markdown: "[![](badge.png)](https://example.com)",
+			want:     "[![a \\[fat\\] cat: badge.png](badge.png)](https://example.com)",
+		},
+	}
+
+	for _, c := range cases {
+		got, err := LabelImages(c.markdown, webpage.MissingOnly, labelFunc)
+
+		if err != nil {
+			t.Errorf("got error %s; wanted no error", err.Error())
+		}
+
+		if got != c.want {
+			t.Errorf("LabelImages(%q) == %q, want %q", c.markdown, got, c.want)
+		}
+	}
+}
+
+func TestLabelImagesDirectives(t *testing.T) {
+	labelFunc := func(imgPath string, prevDescription string) string {
+		return "a cat"
+	}
+
+	input := "<!-- gocaption:ignore-next -->\n![](a.png) ![](b.png)\n\n<!-- gocaption:off -->\n![](c.png) <img src=\"d.png\">\n<!--gocaption:on-->\n\n<!-- gocaption:ignore-next --><img src=\"e.png\"> ![](f.png)\n"
+	want := "<!-- gocaption:ignore-next -->\n![](a.png) ![a cat](b.png)\n\n<!-- gocaption:off -->\n![](c.png) <img src=\"d.png\">\n<!--gocaption:on-->\n\n<!-- gocaption:ignore-next --><img src=\"e.png\"> ![a cat](f.png)\n"
+
+	ignored := []string{}
+
+	got, err := LabelImagesSkipping(input, webpage.MissingOnly, labelFunc, func(src string, alt string, reason string) {
+		if reason == webpage.SkipIgnored {
+			ignored = append(ignored, src)
+		}
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != want {
+		t.Errorf("LabelImages(%q) == %q, want %q", input, got, want)
+	}
+
+	if strings.Join(ignored, " ") != "a.png c.png d.png e.png" {
+		t.Errorf("ignored %v, want a.png, c.png, d.png and e.png", ignored)
+	}
+}
+
+func TestNewDocument(t *testing.T) {
+	if _, err := New("README.md"); err != nil {
+		t.Errorf("got error %s; wanted no error", err.Error())
+	}
+
+	if _, err := New("index.html"); err == nil {
+		t.Errorf("got no error; wanted a *FileTypeError")
+	}
+}
+
+func TestLabelImagesPositions(t *testing.T) {
+	input := "# Pets\n\nA ![cat](cat.png) and\n<img src=\"dog.png\">\n"
+	srcs := []string{}
+
+	_, positions, err := labelImages(input, webpage.MissingOnly, func(src string, alt string) string {
+		srcs = append(srcs, src)
+		return ""
+	}, func(src string, alt string, reason string) {
+		srcs = append(srcs, src)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []webpage.Position{{Line: 3, Column: 3}, {Line: 4, Column: 1}}
+
+	if len(positions) != len(want) || len(srcs) != len(want) {
+		t.Fatalf("got positions %v for %v, want %v", positions, srcs, want)
+	}
+
+	for i := range want {
+		if positions[i] != want[i] {
+			t.Errorf("%s is at %+v, want %+v", srcs[i], positions[i], want[i])
+		}
+	}
+}
+
+func TestLabelReferenceImages(t *testing.T) {
+	labelFunc := func(imgPath string, prevDescription string) string {
+		return "a cat"
+	}
+
+	cases := []struct {
+		markdown string
+		want     string
+	}{
+		{
+			markdown: "![image][]\n\n[image]: cat.png\n",
+			want:     "![a cat][image]\n\n[image]: cat.png\n",
+		},
+		{
+			markdown: "A ![photo] here.\n\n[photo]: cat.png\n",
+			want:     "A ![a cat][photo] here.\n\n[photo]: cat.png\n",
+		},
+		{
+			markdown: "![photo][cat]\n\n[cat]: cat.png\n",
+			want:     "![a cat][cat]\n\n[cat]: cat.png\n",
+		},
+		{
+			markdown: "![a cat]\n\n[a cat]: cat.png\n",
+			want:     "![a cat]\n\n[a cat]: cat.png\n",
+		},
+	}
+
+	for _, c := range cases {
+		got, err := LabelImages(c.markdown, webpage.Overwrite, labelFunc)
+
+		if err != nil {
+			t.Errorf("got error %s; wanted no error", err.Error())
+		}
+
+		if got != c.want {
+			t.Errorf("LabelImages(%q) == %q, want %q", c.markdown, got, c.want)
+		}
+	}
+}
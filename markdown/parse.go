@@ -0,0 +1,440 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// span is a range of bytes in a Markdown document to be replaced.
+type span struct {
+	start, end int
+	// html is true for an inline <img> tag, otherwise the span is the alt
+	// text of a Markdown image.
+	html bool
+	src  string
+	// label is the reference label of a collapsed or shortcut reference
+	// image like ![alt][] or ![alt], where the alt is also the label. The span
+	// of a collapsed reference ends after its "][", so a new alt can be written
+	// as "new alt][label".
+	label string
+	// comment is the text of an HTML comment, which might be a gocaption
+	// directive. A comment span isn't an image.
+	comment string
+}
+
+var (
+	fencePattern      = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	definitionPattern = regexp.MustCompile(`^ {0,3}\[((?:[^\]\\]|\\.)+)\]:[ \t]*(?:<([^>\n]*)>|(\S+))`)
+	imgTagPattern     = regexp.MustCompile(`(?i)^<img[\s/>]`)
+	indentedPattern   = regexp.MustCompile(`^(    | {0,3}\t)`)
+	listItemPattern   = regexp.MustCompile(`^ {0,3}([-+*]|\d{1,9}[.)])([ \t]|$)`)
+)
+
+// normalizeLabel makes reference labels case- and whitespace-insensitive.
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// lines splits a document into lines, keeping each line's "\n", along with
+// whether each line is part of a fenced or indented code block.
+//
+// An indented line only starts a code block after a blank line, since it
+// can't interrupt a paragraph, and never inside a list, where indenting
+// continues the list item.
+func lines(doc string) ([]string, []bool) {
+	all := strings.SplitAfter(doc, "\n")
+	inCode := make([]bool, len(all))
+
+	fence := ""
+	blank := true
+	indented := false
+	inList := false
+
+	for i, line := range all {
+		match := fencePattern.FindStringSubmatch(line)
+		isBlank := strings.TrimSpace(line) == ""
+
+		if fence == "" && !isBlank {
+			switch {
+			case listItemPattern.MatchString(line):
+				inList = true
+			case !indentedPattern.MatchString(line) && blank:
+				inList = false
+			}
+
+			indented = indentedPattern.MatchString(line) && (blank || indented) && !inList
+		}
+
+		blank = isBlank
+
+		switch {
+		case indented && !isBlank:
+			inCode[i] = true
+		case fence == "" && match != nil:
+			fence = match[1]
+			inCode[i] = true
+		case fence != "":
+			inCode[i] = true
+
+			if match != nil && match[1][0] == fence[0] && len(match[1]) >= len(fence) && strings.TrimSpace(line[len(match[0]):]) == "" {
+				fence = ""
+			}
+		}
+	}
+
+	return all, inCode
+}
+
+// definitions finds every link reference definition like `[label]: src "title"`.
+func definitions(doc string) map[string]string {
+	defs := map[string]string{}
+
+	all, inCode := lines(doc)
+
+	for i, line := range all {
+		if inCode[i] {
+			continue
+		}
+
+		match := definitionPattern.FindStringSubmatch(line)
+
+		if match == nil {
+			continue
+		}
+
+		label := normalizeLabel(match[1])
+
+		if _, ok := defs[label]; ok {
+			// the first definition wins
+			continue
+		}
+
+		if match[2] != "" {
+			defs[label] = match[2]
+		} else {
+			defs[label] = match[3]
+		}
+	}
+
+	return defs
+}
+
+// findImages finds every image in a Markdown document, skipping code.
+func findImages(doc string) []span {
+	defs := definitions(doc)
+	spans := []span{}
+
+	all, inCode := lines(doc)
+
+	// blocks of text between fenced code
+	offset := 0
+	blockStart := 0
+
+	flush := func(end int) {
+		spans = append(spans, scanText(doc, blockStart, end, defs)...)
+	}
+
+	for i, line := range all {
+		if inCode[i] {
+			flush(offset)
+			blockStart = offset + len(line)
+		}
+
+		offset += len(line)
+	}
+
+	flush(len(doc))
+
+	return spans
+}
+
+// scanText finds images and comments in doc[start:end], which contains no
+// fenced code.
+func scanText(doc string, start int, end int, defs map[string]string) []span {
+	spans := []span{}
+
+	for i := start; i < end; {
+		switch doc[i] {
+		case '\\':
+			i += 2
+
+		case '`':
+			i = skipCodeSpan(doc, i, end)
+
+		case '<':
+			if strings.HasPrefix(doc[i:end], "<!--") {
+				if close := strings.Index(doc[i+4:end], "-->"); close >= 0 {
+					if comment := doc[i+4 : i+4+close]; strings.TrimSpace(comment) != "" {
+						spans = append(spans, span{start: i, end: i + 4 + close + 3, comment: comment})
+					}
+
+					i += 4 + close + 3
+					continue
+				}
+			}
+
+			if imgTagPattern.MatchString(doc[i:end]) {
+				if tagEnd := findTagEnd(doc, i, end); tagEnd > 0 {
+					spans = append(spans, span{start: i, end: tagEnd, html: true})
+					i = tagEnd
+					continue
+				}
+			}
+
+			i++
+
+		case '!':
+			if i+1 < end && doc[i+1] == '[' {
+				if s, next, ok := parseImage(doc, i, end, defs); ok {
+					spans = append(spans, s)
+					i = next
+					continue
+				}
+			}
+
+			i++
+
+		default:
+			i++
+		}
+	}
+
+	return spans
+}
+
+// skipCodeSpan returns the index after the code span starting at i. A run of
+// backticks without a matching closing run is just text.
+func skipCodeSpan(doc string, i int, end int) int {
+	runEnd := i
+
+	for runEnd < end && doc[runEnd] == '`' {
+		runEnd++
+	}
+
+	run := doc[i:runEnd]
+
+	for j := runEnd; j < end; {
+		close := strings.Index(doc[j:end], run)
+
+		if close < 0 {
+			break
+		}
+
+		closeStart := j + close
+		closeEnd := closeStart + len(run)
+
+		// the closing run must be exactly as long as the opening one
+		if closeEnd < end && doc[closeEnd] == '`' {
+			for closeEnd < end && doc[closeEnd] == '`' {
+				closeEnd++
+			}
+
+			j = closeEnd
+			continue
+		}
+
+		return closeEnd
+	}
+
+	return runEnd
+}
+
+// findTagEnd returns the index after the '>' closing the tag at i, or -1.
+func findTagEnd(doc string, i int, end int) int {
+	var quote byte
+
+	for j := i + 1; j < end; j++ {
+		switch {
+		case quote != 0:
+			if doc[j] == quote {
+				quote = 0
+			}
+		case doc[j] == '"' || doc[j] == '\'':
+			quote = doc[j]
+		case doc[j] == '>':
+			return j + 1
+		}
+	}
+
+	return -1
+}
+
+// findBracket returns the index of the ']' matching the '[' at i, or -1.
+func findBracket(doc string, i int, end int) int {
+	depth := 0
+
+	for j := i; j < end; j++ {
+		switch doc[j] {
+		case '\\':
+			j++
+		case '[':
+			depth++
+		case ']':
+			depth--
+
+			if depth == 0 {
+				return j
+			}
+		case '`':
+			j = skipCodeSpan(doc, j, end) - 1
+		}
+	}
+
+	return -1
+}
+
+// parseImage parses an inline or reference image starting with "![" at i.
+func parseImage(doc string, i int, end int, defs map[string]string) (span, int, bool) {
+	altStart := i + 2
+	altEnd := findBracket(doc, i+1, end)
+
+	if altEnd < 0 {
+		return span{}, 0, false
+	}
+
+	alt := doc[altStart:altEnd]
+	next := altEnd + 1
+
+	// inline: ![alt](src "title")
+	if next < end && doc[next] == '(' {
+		if src, after, ok := parseDestination(doc, next+1, end); ok {
+			return span{start: altStart, end: altEnd, src: src}, after, true
+		}
+	}
+
+	// full or collapsed reference: ![alt][label] or ![alt][]
+	if next < end && doc[next] == '[' {
+		labelEnd := findBracket(doc, next, end)
+
+		if labelEnd > 0 {
+			label := doc[next+1 : labelEnd]
+
+			if strings.TrimSpace(label) == "" {
+				if src, ok := defs[normalizeLabel(alt)]; ok {
+					return span{start: altStart, end: next + 1, src: src, label: alt}, labelEnd + 1, true
+				}
+
+				return span{}, 0, false
+			}
+
+			if src, ok := defs[normalizeLabel(label)]; ok {
+				return span{start: altStart, end: altEnd, src: src}, labelEnd + 1, true
+			}
+
+			return span{}, 0, false
+		}
+	}
+
+	// shortcut reference: ![alt]
+	if src, ok := defs[normalizeLabel(alt)]; ok {
+		return span{start: altStart, end: altEnd, src: src, label: alt}, next, true
+	}
+
+	return span{}, 0, false
+}
+
+// parseDestination parses `src "title")` starting just after the '('.
+func parseDestination(doc string, i int, end int) (string, int, bool) {
+	i = skipSpace(doc, i, end)
+
+	var src string
+
+	if i < end && doc[i] == '<' {
+		close := strings.IndexAny(doc[i+1:end], ">\n")
+
+		if close < 0 || doc[i+1+close] != '>' {
+			return "", 0, false
+		}
+
+		src = doc[i+1 : i+1+close]
+		i += close + 2
+	} else {
+		srcStart := i
+		depth := 0
+
+	dest:
+		for ; i < end; i++ {
+			switch doc[i] {
+			case '\\':
+				i++
+			case '(':
+				depth++
+			case ')':
+				if depth == 0 {
+					break dest
+				}
+				depth--
+			case ' ', '\t', '\n':
+				break dest
+			}
+		}
+
+		if i > end {
+			i = end
+		}
+
+		src = doc[srcStart:i]
+	}
+
+	i = skipSpace(doc, i, end)
+
+	// optional title
+	if i < end && (doc[i] == '"' || doc[i] == '\'' || doc[i] == '(') {
+		closer := doc[i]
+
+		if closer == '(' {
+			closer = ')'
+		}
+
+		j := i + 1
+
+		for j < end && doc[j] != closer {
+			if doc[j] == '\\' {
+				j++
+			}
+			j++
+		}
+
+		if j >= end {
+			return "", 0, false
+		}
+
+		i = skipSpace(doc, j+1, end)
+	}
+
+	if i >= end || doc[i] != ')' {
+		return "", 0, false
+	}
+
+	return strings.Replace(src, "\\", "", -1), i + 1, true
+}
+
+// skipSpace skips spaces, tabs and at most one newline.
+func skipSpace(doc string, i int, end int) int {
+	newline := false
+
+	for i < end {
+		switch doc[i] {
+		case ' ', '\t':
+		case '\n':
+			if newline {
+				return i
+			}
+			newline = true
+		default:
+			return i
+		}
+		i++
+	}
+
+	return i
+}
+
+// escapeAlt makes a caption safe to put between the brackets of an image.
+func escapeAlt(alt string) string {
+	alt = strings.Join(strings.Fields(alt), " ")
+
+	replacer := strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`)
+
+	return replacer.Replace(alt)
+}
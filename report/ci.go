@@ -0,0 +1,279 @@
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rules of the results in SARIF and JUnit reports.
+const (
+	// MissingAltRule results are images in a page without an alt.
+	MissingAltRule = "missing-alt"
+	// CaptionFailedRule results are images that couldn't be resolved or
+	// captioned.
+	CaptionFailedRule = "caption-failed"
+)
+
+// relativePath makes an absolute path relative to the working directory, if
+// it is inside it, so CI can match it to a file in the repository.
+func relativePath(path string) string {
+	wd, err := os.Getwd()
+
+	if err != nil || !filepath.IsAbs(path) {
+		return filepath.ToSlash(path)
+	}
+
+	rel, err := filepath.Rel(wd, path)
+
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(path)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// rule is the rule a record breaks and a message about it, or "" if it breaks
+// none.
+func rule(record Record) (string, string) {
+	switch {
+	case record.Action == Failed && record.Src == "":
+		return CaptionFailedRule, fmt.Sprintf("Can't caption %s: %s", record.Page, record.Message)
+	case record.Action == Failed:
+		return CaptionFailedRule, fmt.Sprintf("Can't caption %s: %s", record.Src, record.Message)
+	case record.MissingAlt() && record.Action == Added:
+		return MissingAltRule, fmt.Sprintf("%s has no alt; suggested alt: %q", record.Src, record.NewAlt)
+	case record.MissingAlt():
+		return MissingAltRule, fmt.Sprintf("%s has no alt", record.Src)
+	}
+
+	return "", ""
+}
+
+type sarifWriter struct {
+	w       io.Writer
+	results []sarifResult
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+var sarifRules = []sarifRule{
+	{MissingAltRule, sarifMessage{"Images need alt text for people using screen readers."}},
+	{CaptionFailedRule, sarifMessage{"The image couldn't be resolved or captioned."}},
+}
+
+func (s *sarifWriter) Write(record Record) error {
+	ruleID, message := rule(record)
+
+	if ruleID == "" {
+		return nil
+	}
+
+	level := "warning"
+
+	if ruleID == CaptionFailedRule {
+		level = "error"
+	}
+
+	location := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{relativePath(record.Page)}}
+
+	if record.Page == "" {
+		location.ArtifactLocation.URI = relativePath(record.Path)
+	}
+
+	if record.Line > 0 {
+		location.Region = &sarifRegion{record.Line, record.Column}
+	}
+
+	s.results = append(s.results, sarifResult{ruleID, level, sarifMessage{message}, []sarifLocation{{location}}})
+
+	return nil
+}
+
+func (s *sarifWriter) Close(summary *Summary) error {
+	results := s.results
+
+	if results == nil {
+		results = []sarifResult{}
+	}
+
+	type driver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+
+	type tool struct {
+		Driver driver `json:"driver"`
+	}
+
+	type run struct {
+		Tool tool `json:"tool"`
+		// columns count characters, like webpage.Position
+		ColumnKind string        `json:"columnKind"`
+		Results    []sarifResult `json:"results"`
+	}
+
+	encoder := json.NewEncoder(s.w)
+	encoder.SetIndent("", "\t")
+
+	return encoder.Encode(struct {
+		Schema  string `json:"$schema"`
+		Version string `json:"version"`
+		Runs    []run  `json:"runs"`
+	}{
+		"https://json.schemastore.org/sarif-2.1.0.json",
+		"2.1.0",
+		[]run{{tool{driver{"gocaption", "https://github.com/samuelstevens/gocaption", sarifRules}}, "unicodeCodePoints", results}},
+	})
+}
+
+// junitWriter writes a test case for every page, and every image captioned
+// on its own, in the order they were first written.
+type junitWriter struct {
+	w        io.Writer
+	names    []string
+	problems map[string][]string
+	failed   map[string]bool
+}
+
+func (j *junitWriter) Write(record Record) error {
+	if j.problems == nil {
+		j.problems = map[string][]string{}
+		j.failed = map[string]bool{}
+	}
+
+	name := relativePath(record.Page)
+
+	if record.Page == "" {
+		name = relativePath(record.Path)
+	}
+
+	if _, ok := j.problems[name]; !ok {
+		j.names = append(j.names, name)
+		j.problems[name] = []string{}
+	}
+
+	ruleID, message := rule(record)
+
+	if ruleID == "" {
+		return nil
+	}
+
+	if record.Line > 0 {
+		message = fmt.Sprintf("%d:%d: %s", record.Line, record.Column, message)
+	}
+
+	j.problems[name] = append(j.problems[name], message)
+	j.failed[name] = j.failed[name] || ruleID == CaptionFailedRule
+
+	return nil
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitTestCase struct {
+	Name      string `xml:"name,attr"`
+	ClassName string `xml:"classname,attr"`
+	// images that failed are errors, and images missing an alt are failures
+	Error   *junitProblem `xml:"error,omitempty"`
+	Failure *junitProblem `xml:"failure,omitempty"`
+}
+
+func (j *junitWriter) Close(summary *Summary) error {
+	type testSuite struct {
+		Name      string          `xml:"name,attr"`
+		Tests     int             `xml:"tests,attr"`
+		Failures  int             `xml:"failures,attr"`
+		Errors    int             `xml:"errors,attr"`
+		TestCases []junitTestCase `xml:"testcase"`
+	}
+
+	suite := testSuite{Name: "gocaption", TestCases: []junitTestCase{}}
+
+	for _, name := range j.names {
+		testCase := junitTestCase{Name: name, ClassName: "gocaption"}
+		problems := j.problems[name]
+
+		if len(problems) > 0 {
+			problem := &junitProblem{
+				Message: fmt.Sprintf("%d image(s) have no alt or couldn't be captioned", len(problems)),
+				Type:    MissingAltRule,
+				Text:    strings.Join(problems, "\n"),
+			}
+
+			if j.failed[name] {
+				problem.Type = CaptionFailedRule
+				testCase.Error = problem
+				suite.Errors++
+			} else {
+				testCase.Failure = problem
+				suite.Failures++
+			}
+		}
+
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	suite.Tests = len(suite.TestCases)
+
+	if _, err := io.WriteString(j.w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(j.w)
+	encoder.Indent("", "\t")
+
+	err := encoder.Encode(struct {
+		XMLName xml.Name    `xml:"testsuites"`
+		Suites  []testSuite `xml:"testsuite"`
+	}{Suites: []testSuite{suite}})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(j.w, "\n")
+
+	return err
+}
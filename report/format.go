@@ -0,0 +1,121 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// Text is the format of the usual human-readable output, which doesn't use
+// a Writer.
+const Text = "text"
+
+// Writer writes the Records of a run, then its Summary.
+type Writer interface {
+	Write(record Record) error
+	Close(summary *Summary) error
+}
+
+// New returns a Writer for a format: json writes one object with every record
+// and the summary, ndjson writes a line for every record and then one for the
+// summary, and csv writes a header and a row for every record, but no
+// summary. sarif and junit only write images missing an alt and images that
+// failed, as SARIF 2.1.0 results and JUnit XML test cases for CI.
+func New(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case "sarif":
+		return &sarifWriter{w: w}, nil
+	case "junit":
+		return &junitWriter{w: w}, nil
+	case "json":
+		return &jsonWriter{w: w, records: []Record{}}, nil
+	case "ndjson":
+		return &ndjsonWriter{json.NewEncoder(w)}, nil
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	}
+
+	return nil, &FormatError{format}
+}
+
+type jsonWriter struct {
+	w       io.Writer
+	records []Record
+}
+
+func (j *jsonWriter) Write(record Record) error {
+	j.records = append(j.records, record)
+	return nil
+}
+
+func (j *jsonWriter) Close(summary *Summary) error {
+	encoder := json.NewEncoder(j.w)
+	encoder.SetIndent("", "\t")
+
+	return encoder.Encode(struct {
+		Records []Record `json:"records"`
+		Summary *Summary `json:"summary"`
+	}{j.records, summary})
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(record Record) error {
+	return n.encoder.Encode(record)
+}
+
+func (n *ndjsonWriter) Close(summary *Summary) error {
+	return n.encoder.Encode(struct {
+		Summary *Summary `json:"summary"`
+	}{summary})
+}
+
+// csvHeader names the columns of a csv report.
+var csvHeader = []string{"page", "src", "line", "column", "path", "hash", "old_alt", "new_alt", "confidence", "source", "action", "reason", "error", "message"}
+
+type csvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (c *csvWriter) Write(record Record) error {
+	if !c.wroteHeader {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+
+		c.wroteHeader = true
+	}
+
+	return c.w.Write([]string{
+		record.Page,
+		record.Src,
+		strconv.Itoa(record.Line),
+		strconv.Itoa(record.Column),
+		record.Path,
+		record.Hash,
+		record.OldAlt,
+		record.NewAlt,
+		strconv.FormatFloat(record.Confidence, 'f', -1, 64),
+		record.Source,
+		record.Action,
+		record.Reason,
+		record.Error,
+		record.Message,
+	})
+}
+
+func (c *csvWriter) Close(summary *Summary) error {
+	if !c.wroteHeader {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+
+	c.w.Flush()
+
+	return c.w.Error()
+}
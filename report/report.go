@@ -0,0 +1,250 @@
+// Package report describes what a run did with every image, in formats other
+// programs can read.
+package report
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/samuelstevens/gocaption/api"
+	"github.com/samuelstevens/gocaption/caption"
+	"github.com/samuelstevens/gocaption/webpage"
+)
+
+// What a run did with an image.
+const (
+	// Added images had no alt and got one.
+	Added = "added"
+	// Replaced images had an alt the AltPolicy replaced.
+	Replaced = "replaced"
+	// Unchanged images kept the alt they already had.
+	Unchanged = "unchanged"
+	// Captioned images were captioned on their own rather than in a page.
+	Captioned = "captioned"
+	// Queued images wait for "gocaption review".
+	Queued = "queued"
+	// Skipped images were left alone; Reason says why.
+	Skipped = "skipped"
+	// Failed images couldn't be resolved or captioned; Error says why.
+	Failed = "failed"
+)
+
+// Why an image was skipped, besides the webpage.Skip reasons.
+const (
+	// LowConfidence images had a low-confidence caption and the skip
+	// policy.
+	LowConfidence = "low-confidence"
+	// Rejected images had their caption rejected in review.
+	Rejected = "rejected"
+)
+
+// Record is an occurrence of an image in a page, or an image captioned on its
+// own, and what the run did with it.
+type Record struct {
+	// Page is the page the image is in; it is empty for images captioned on
+	// their own.
+	Page string `json:"page"`
+	// Src is the image as the page refers to it.
+	Src string `json:"src"`
+	// Line and Column are where the image is in the page, if it is in one.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+	// Path is the path or URL Src resolved to.
+	Path       string  `json:"path"`
+	Hash       string  `json:"hash"`
+	OldAlt     string  `json:"old_alt"`
+	NewAlt     string  `json:"new_alt"`
+	Confidence float64 `json:"confidence"`
+	// Source is where the caption came from: cache, api or existing.
+	Source string `json:"source"`
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+	// Error is a short code for why the image failed, like "unresolved".
+	Error   string `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Summary totals a run.
+type Summary struct {
+	Pages  int `json:"pages"`
+	Images int `json:"images"`
+	// Actions counts images by Action.
+	Actions map[string]int `json:"actions"`
+	// Errors counts failed images by Error.
+	Errors   map[string]int `json:"errors"`
+	Requests int            `json:"requests"`
+	Retries  int            `json:"retries"`
+}
+
+// NewSummary returns an empty Summary.
+func NewSummary() *Summary {
+	return &Summary{Actions: map[string]int{}, Errors: map[string]int{}}
+}
+
+// Add counts a record.
+func (s *Summary) Add(record Record) {
+	s.Images++
+	s.Actions[record.Action]++
+
+	if record.Error != "" {
+		s.Errors[record.Error]++
+	}
+}
+
+// FromOccurrence builds the Record of an image in a page.
+func FromOccurrence(page string, occurrence webpage.Occurrence) Record {
+	record := Record{
+		Page:   page,
+		Src:    occurrence.Src,
+		Line:   occurrence.Position.Line,
+		Column: occurrence.Position.Column,
+		OldAlt: occurrence.PrevDescription,
+	}
+
+	if occurrence.Source != nil {
+		record.Path = occurrence.Source.Name()
+	}
+
+	switch {
+	case occurrence.Skipped != "":
+		record.Action = Skipped
+		record.Reason = occurrence.Skipped
+		record.NewAlt = occurrence.PrevDescription
+		record.Source = caption.FromExisting
+
+	case occurrence.Err != nil:
+		record.fail(occurrence.Err)
+		record.NewAlt = occurrence.PrevDescription
+
+	default:
+		record.fill(occurrence.Caption, occurrence.PrevDescription)
+	}
+
+	return record
+}
+
+// FromCaption builds the Record of an image captioned on its own.
+func FromCaption(path string, c *caption.Caption, err error) Record {
+	record := Record{Src: path, Path: path}
+
+	if err != nil {
+		record.fail(err)
+		return record
+	}
+
+	record.fill(c, "")
+
+	if record.Action == Added {
+		record.Action = Captioned
+	}
+
+	return record
+}
+
+// MissingAlt checks if the image is in a page without an alt, not counting
+// decorative images or images left alone on purpose.
+func (r Record) MissingAlt() bool {
+	if r.Page == "" || r.OldAlt != "" {
+		return false
+	}
+
+	switch r.Action {
+	case Added, Queued, Failed:
+		return true
+	case Skipped:
+		return r.Reason == LowConfidence || r.Reason == Rejected
+	}
+
+	return false
+}
+
+func (r *Record) fail(err error) {
+	r.Action = Failed
+	r.Error = ErrorCode(err)
+	r.Message = err.Error()
+}
+
+// fill fills in a Record from the caption of an image whose alt was oldAlt.
+func (r *Record) fill(c *caption.Caption, oldAlt string) {
+	r.Hash = c.Hash
+	r.NewAlt = c.Description
+	r.Confidence = c.Confidence
+	r.Source = c.Origin
+
+	if r.Path == "" {
+		r.Path = c.Source
+	}
+
+	switch {
+	case c.Status == caption.Pending:
+		r.Action = Queued
+	case c.Status == caption.Rejected:
+		r.Action = Skipped
+		r.Reason = Rejected
+	case c.LowConfidence == caption.Skip.String() && c.Description == oldAlt:
+		r.Action = Skipped
+		r.Reason = LowConfidence
+	case c.Description == "" || c.Description == oldAlt:
+		r.Action = Unchanged
+	case oldAlt == "":
+		r.Action = Added
+	default:
+		r.Action = Replaced
+	}
+
+	if r.NewAlt == "" {
+		r.NewAlt = oldAlt
+	}
+}
+
+// ErrorCode is a short, stable name for the kind of error, like "unresolved"
+// or "http-429".
+func ErrorCode(err error) string {
+	var (
+		resolveErr    *caption.ResolveError
+		fetchErr      *caption.FetchError
+		dataURIErr    *caption.DataURIError
+		languageErr   *api.LanguageError
+		statusErr     *api.StatusError
+		cassetteErr   *api.CassetteError
+		confidenceErr *api.ConfidenceError
+	)
+
+	switch {
+	case errors.As(err, &resolveErr):
+		return "unresolved"
+	case errors.As(err, &fetchErr):
+		return "fetch"
+	case errors.As(err, &dataURIErr):
+		return "data-uri"
+	case errors.As(err, &languageErr):
+		return "language"
+	case errors.As(err, &statusErr):
+		return "http-" + strconv.Itoa(statusErr.StatusCode)
+	case errors.As(err, &cassetteErr):
+		return "cassette"
+	case errors.As(err, &confidenceErr):
+		return LowConfidence
+	case errors.Is(err, api.ErrorBudget):
+		return "budget"
+	case errors.Is(err, api.ErrorNoLabel):
+		return "no-caption"
+	case errors.Is(err, api.ErrorAuth):
+		return "auth"
+	case os.IsNotExist(err):
+		return "not-found"
+	}
+
+	return "error"
+}
+
+// FormatError occurs when a report format isn't known.
+type FormatError struct {
+	Format string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("%q is not a report format (text, json, ndjson, csv, sarif or junit)", e.Format)
+}
@@ -0,0 +1,204 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/samuelstevens/gocaption/api"
+	"github.com/samuelstevens/gocaption/caption"
+	"github.com/samuelstevens/gocaption/webpage"
+)
+
+func TestFromOccurrence(t *testing.T) {
+	cases := []struct {
+		occurrence webpage.Occurrence
+		action     string
+		reason     string
+		newAlt     string
+	}{
+		{webpage.Occurrence{Src: "a.png", Caption: &caption.Caption{Description: "a cat"}}, Added, "", "a cat"},
+		{webpage.Occurrence{Src: "a.png", PrevDescription: "image", Caption: &caption.Caption{Description: "a cat"}}, Replaced, "", "a cat"},
+		{webpage.Occurrence{Src: "a.png", PrevDescription: "a cat", Caption: &caption.Caption{Description: "a cat"}}, Unchanged, "", "a cat"},
+		{webpage.Occurrence{Src: "a.png", Caption: &caption.Caption{Description: "", Status: caption.Pending}}, Queued, "", ""},
+		{webpage.Occurrence{Src: "a.png", Caption: &caption.Caption{Description: "", Status: caption.Rejected}}, Skipped, Rejected, ""},
+		{webpage.Occurrence{Src: "a.png", Caption: &caption.Caption{Description: "", LowConfidence: caption.Skip.String()}}, Skipped, LowConfidence, ""},
+		{webpage.Occurrence{Src: "a.png", PrevDescription: "my cat", Skipped: webpage.SkipHasAlt}, Skipped, webpage.SkipHasAlt, "my cat"},
+		{webpage.Occurrence{Src: "a.png", Err: &caption.ResolveError{}}, Failed, "", ""},
+	}
+
+	for _, c := range cases {
+		record := FromOccurrence("index.html", c.occurrence)
+
+		if record.Action != c.action || record.Reason != c.reason || record.NewAlt != c.newAlt {
+			t.Errorf("FromOccurrence(%+v) == %s/%s %q, want %s/%s %q", c.occurrence, record.Action, record.Reason, record.NewAlt, c.action, c.reason, c.newAlt)
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{&caption.ResolveError{}, "unresolved"},
+		{&caption.FetchError{}, "fetch"},
+		{fmt.Errorf("describing: %w", &api.StatusError{StatusCode: 429}), "http-429"},
+		{api.ErrorBudget, "budget"},
+		{fmt.Errorf("oops"), "error"},
+	}
+
+	for _, c := range cases {
+		if got := ErrorCode(c.err); got != c.want {
+			t.Errorf("ErrorCode(%v) == %q, want %q", c.err, got, c.want)
+		}
+	}
+}
+
+func TestFormats(t *testing.T) {
+	records := []Record{
+		{Page: "index.html", Src: "a.png", NewAlt: "a cat, sitting", Action: Added},
+		{Page: "index.html", Src: "b\tc.png", Action: Failed, Error: "unresolved"},
+	}
+
+	write := func(format string) string {
+		var buf bytes.Buffer
+
+		writer, err := New(format, &buf)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		summary := NewSummary()
+
+		for _, record := range records {
+			summary.Add(record)
+
+			if err := writer.Write(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := writer.Close(summary); err != nil {
+			t.Fatal(err)
+		}
+
+		return buf.String()
+	}
+
+	var report struct {
+		Records []Record
+		Summary Summary
+	}
+
+	if err := json.Unmarshal([]byte(write("json")), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Records) != 2 || report.Summary.Images != 2 || report.Summary.Errors["unresolved"] != 1 {
+		t.Errorf("json report has %d records and summary %+v", len(report.Records), report.Summary)
+	}
+
+	lines := strings.Split(strings.TrimSpace(write("ndjson")), "\n")
+
+	if len(lines) != 3 || !strings.HasPrefix(lines[2], `{"summary":`) {
+		t.Errorf("ndjson report should have a line per record and a summary:\n%s", strings.Join(lines, "\n"))
+	}
+
+	csv := write("csv")
+
+	if strings.Count(csv, "\n") != 3 || !strings.Contains(csv, `"a cat, sitting"`) {
+		t.Errorf("csv report should have a header and a quoted row per record:\n%s", csv)
+	}
+
+	if _, err := New("xml", &bytes.Buffer{}); err == nil {
+		t.Errorf("New should reject unknown formats")
+	}
+}
+
+func TestCIFormats(t *testing.T) {
+	records := []Record{
+		{Page: "index.html", Src: "a.png", Line: 3, Column: 5, NewAlt: "a cat", Action: Added},
+		{Page: "index.html", Src: "b.png", Line: 4, Column: 1, OldAlt: "a dog", Action: Skipped, Reason: webpage.SkipHasAlt},
+		{Page: "about.html", Src: "c.png", Line: 1, Column: 1, Action: Failed, Error: "unresolved", Message: "not found"},
+		{Page: "blank.html", Src: "d.png", Action: Skipped, Reason: webpage.SkipDecorative},
+	}
+
+	write := func(format string) []byte {
+		var buf bytes.Buffer
+
+		writer, err := New(format, &buf)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, record := range records {
+			if err := writer.Write(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := writer.Close(NewSummary()); err != nil {
+			t.Fatal(err)
+		}
+
+		return buf.Bytes()
+	}
+
+	var sarif struct {
+		Version string
+		Runs    []struct {
+			Results []struct {
+				RuleID    string
+				Level     string
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           struct{ StartLine, StartColumn int }
+					}
+				}
+			}
+		}
+	}
+
+	if err := json.Unmarshal(write("sarif"), &sarif); err != nil {
+		t.Fatal(err)
+	}
+
+	if sarif.Version != "2.1.0" || len(sarif.Runs) != 1 || len(sarif.Runs[0].Results) != 2 {
+		t.Fatalf("sarif report should have a result for the missing alt and the failure: %+v", sarif)
+	}
+
+	missing := sarif.Runs[0].Results[0]
+	location := missing.Locations[0].PhysicalLocation
+
+	if missing.RuleID != MissingAltRule || location.ArtifactLocation.URI != "index.html" || location.Region.StartLine != 3 || location.Region.StartColumn != 5 {
+		t.Errorf("got result %+v, want a missing alt at index.html:3:5", missing)
+	}
+
+	if failed := sarif.Runs[0].Results[1]; failed.RuleID != CaptionFailedRule || failed.Level != "error" {
+		t.Errorf("got result %+v, want a failed caption", failed)
+	}
+
+	var junit struct {
+		Suites []struct {
+			Tests    int `xml:"tests,attr"`
+			Failures int `xml:"failures,attr"`
+			Errors   int `xml:"errors,attr"`
+		} `xml:"testsuite"`
+	}
+
+	if err := xml.Unmarshal(write("junit"), &junit); err != nil {
+		t.Fatal(err)
+	}
+
+	// a test case for every page
+	if len(junit.Suites) != 1 || junit.Suites[0].Tests != 3 || junit.Suites[0].Failures != 1 || junit.Suites[0].Errors != 1 {
+		t.Errorf("got junit suites %+v, want 3 tests with 1 failure and 1 error", junit.Suites)
+	}
+}
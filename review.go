@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/samuelstevens/gocaption/caption"
+	"github.com/samuelstevens/gocaption/cli"
+)
+
+const reviewPrompt = "Accept (enter), pick a candidate by number, (e)dit, (r)eject, (s)kip or (q)uit: "
+
+// reviewCommand runs "gocaption review" and returns the exit status.
+func reviewCommand(opts *cli.ReviewOptions) int {
+	cache, err := caption.OpenCache(opts.CacheFile)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	defer func() {
+		if err := cache.Close(); err != nil {
+			log.Fatalf("Couldn't save caption cache: %s.\n", err.Error())
+		}
+	}()
+
+	pending, err := caption.PendingCaptions(cache)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	filter := &caption.Filter{Pattern: opts.Pattern}
+	matches := []*caption.Caption{}
+
+	for _, c := range pending {
+		if filter.Match(c) {
+			matches = append(matches, c)
+		}
+	}
+
+	if len(matches) == 0 {
+		fmt.Println("No captions are waiting for review.")
+		return 0
+	}
+
+	reviewed, err := review(cache, matches, os.Stdin, os.Stdout)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	fmt.Printf("Reviewed %d of %d captions.\n", reviewed, len(matches))
+
+	return 0
+}
+
+// review asks about each caption on out, reading answers from in, and returns
+// how many captions were accepted or rejected.
+func review(cache caption.Store, captions []*caption.Caption, in io.Reader, out io.Writer) (int, error) {
+	scanner := bufio.NewScanner(in)
+	reviewed := 0
+
+	// ask reads a line of input, returning false at the end of the input
+	ask := func(prompt string) (string, bool) {
+		fmt.Fprint(out, prompt)
+
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return "", false
+		}
+
+		return strings.TrimSpace(scanner.Text()), true
+	}
+
+	for i, c := range captions {
+		fmt.Fprintf(out, "\n[%d/%d] %s\n", i+1, len(captions), c.Source)
+
+		if c.Language != "" {
+			fmt.Fprintf(out, "Language: %s\n", c.Language)
+		}
+
+		fmt.Fprintf(out, "Caption: %s (%.0f%% confident)\n", c.Description, 100*c.Confidence)
+
+		for j, candidate := range c.Candidates {
+			fmt.Fprintf(out, "  %d) %s (%.0f%%)\n", j+1, candidate.Text, 100*candidate.Confidence)
+		}
+
+	prompt:
+		for {
+			answer, ok := ask(reviewPrompt)
+
+			if !ok {
+				return reviewed, scanner.Err()
+			}
+
+			description := ""
+
+			switch strings.ToLower(answer) {
+			case "", "a":
+				description = c.Description
+			case "e":
+				if description, ok = ask("Alt text: "); !ok {
+					return reviewed, scanner.Err()
+				}
+
+				if description == "" {
+					continue prompt
+				}
+			case "r":
+				if err := caption.Reject(cache, c); err != nil {
+					return reviewed, err
+				}
+
+				reviewed++
+				break prompt
+			case "s":
+				break prompt
+			case "q":
+				return reviewed, nil
+			default:
+				n, err := strconv.Atoi(answer)
+
+				if err != nil || n < 1 || n > len(c.Candidates) {
+					fmt.Fprintf(out, "Unknown answer %q.\n", answer)
+					continue prompt
+				}
+
+				description = c.Candidates[n-1].Text
+			}
+
+			if err := caption.Approve(cache, c, description); err != nil {
+				return reviewed, err
+			}
+
+			reviewed++
+			break prompt
+		}
+	}
+
+	return reviewed, nil
+}
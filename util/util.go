@@ -5,7 +5,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,10 +19,15 @@ func HashFile(filepath string) (string, error) {
 	}
 	defer file.Close()
 
+	return HashReader(file)
+}
+
+// HashReader returns a SHA1 hash of everything in a reader, the same way HashFile hashes files
+func HashReader(r io.Reader) (string, error) {
 	hash := sha1.New()
 
-	if _, err := io.Copy(hash, file); err != nil {
-		log.Fatal(err)
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
 	}
 
 	return base64.URLEncoding.EncodeToString(hash.Sum(nil)), nil
@@ -164,6 +169,41 @@ func ExpandUserDirectory(path string) string {
 	return path
 }
 
+// WriteFileAtomic writes data to a temporary file next to path and renames it
+// over path, so path is never left half-written.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+
+	if err != nil {
+		return err
+	}
+
+	tmpPath := tmp.Name()
+
+	// clean up if anything goes wrong before the rename
+	defer os.Remove(tmpPath)
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
 // StringSet is a set of strings
 type StringSet map[string]struct{}
 
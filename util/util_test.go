@@ -1,6 +1,7 @@
 package util
 
 import (
+	"io/ioutil"
 	"path/filepath"
 	"reflect"
 	"testing"
@@ -183,3 +184,34 @@ func TestGreatestCommonAbs(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cassette.json")
+
+	for _, want := range []string{"first", "second"} {
+		if err := WriteFileAtomic(path, []byte(want), 0644); err != nil {
+			t.Fatalf("got error %s; wanted no error", err.Error())
+		}
+
+		got, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(got) != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	files, err := ioutil.ReadDir(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Errorf("left %d files behind, want only %s", len(files), path)
+	}
+}
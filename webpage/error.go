@@ -2,11 +2,29 @@ package webpage
 
 import "fmt"
 
-// FileTypeError occurs when a WebPage doesn't get an .html file
+// FileTypeError occurs when a WebPage doesn't get an HTML file
 type FileTypeError struct {
 	path string
 }
 
 func (e *FileTypeError) Error() string {
-	return fmt.Sprintf("%s is not an .html file", e.path)
+	return fmt.Sprintf("%s is not an HTML file", e.path)
+}
+
+// AltPolicyError occurs when an alt policy name isn't known
+type AltPolicyError struct {
+	name string
+}
+
+func (e *AltPolicyError) Error() string {
+	return fmt.Sprintf("%q is not an alt policy (missing-only, empty-only, overwrite or low-quality)", e.name)
+}
+
+// XMLError occurs when labeling would make an XHTML document malformed
+type XMLError struct {
+	err error
+}
+
+func (e *XMLError) Error() string {
+	return fmt.Sprintf("labeled XHTML is not well-formed: %s", e.err.Error())
 }
@@ -0,0 +1,79 @@
+package webpage
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// optOutAttr set to "skip" on an image leaves it for a human to caption.
+	optOutAttr  = "data-gocaption"
+	optOutValue = "skip"
+
+	ignoreNextDirective = "gocaption:ignore-next"
+	offDirective        = "gocaption:off"
+	onDirective         = "gocaption:on"
+)
+
+// Directives keeps track of gocaption comments. HTML and Markdown documents
+// honor the same ones.
+type Directives struct {
+	off        bool
+	ignoreNext bool
+}
+
+// Comment updates the directives with the text of a comment, which is only a
+// directive if it is one of the gocaption ones.
+func (d *Directives) Comment(comment string) {
+	switch strings.ToLower(strings.TrimSpace(comment)) {
+	case ignoreNextDirective:
+		d.ignoreNext = true
+	case offDirective:
+		d.off = true
+	case onDirective:
+		d.off = false
+	}
+}
+
+// Off reports if images are ignored until a gocaption:on comment.
+func (d *Directives) Off() bool {
+	return d.off
+}
+
+// Ignore reports if the next image is ignored, using up any
+// gocaption:ignore-next comment.
+func (d *Directives) Ignore() bool {
+	if d.ignoreNext {
+		d.ignoreNext = false
+		return true
+	}
+
+	return d.off
+}
+
+// optedOut checks if an image is marked data-gocaption="skip".
+func optedOut(n *html.Node) bool {
+	val, _ := getAttr(n.Attr, optOutAttr)
+
+	return strings.EqualFold(strings.TrimSpace(val), optOutValue)
+}
+
+// decorative checks if an image is marked as decorative. An empty alt only
+// counts when the policy isn't to fill in empty alts.
+func decorative(n *html.Node, policy AltPolicy) bool {
+	role, _ := getAttr(n.Attr, "role")
+
+	switch strings.ToLower(strings.TrimSpace(role)) {
+	case "presentation", "none":
+		return true
+	}
+
+	if hidden, _ := getAttr(n.Attr, "aria-hidden"); strings.EqualFold(strings.TrimSpace(hidden), "true") {
+		return true
+	}
+
+	alt, hasAlt := getAttr(n.Attr, "alt")
+
+	return hasAlt && alt == "" && policy != EmptyOnly
+}
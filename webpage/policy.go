@@ -0,0 +1,102 @@
+package webpage
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// AltPolicy decides which images get a new alt.
+type AltPolicy int
+
+const (
+	// MissingOnly labels images without an alt attribute.
+	MissingOnly AltPolicy = iota
+	// EmptyOnly labels images without an alt attribute or with an empty one.
+	EmptyOnly
+	// Overwrite labels every image.
+	Overwrite
+	// LowQuality labels images without an alt attribute or with a junk alt
+	// like a filename or "image".
+	LowQuality
+)
+
+var altPolicyNames = map[AltPolicy]string{
+	MissingOnly: "missing-only",
+	EmptyOnly:   "empty-only",
+	Overwrite:   "overwrite",
+	LowQuality:  "low-quality",
+}
+
+var (
+	imageExtPattern   = regexp.MustCompile(`(?i)\.(png|jpe?g|gif|webp|avif|svg|bmp|tiff?|ico)$`)
+	genericAltPattern = regexp.MustCompile(`(?i)^(a |an |the )?(image|img|photo|photograph|picture|pic|graphic|screenshot|screen shot|untitled|placeholder|alt|alt text|spacer|blank)([\s_-]*\d+)?$`)
+	cameraAltPattern  = regexp.MustCompile(`(?i)^(img|dsc|dscn|dscf|pxl|mvimg|image|photo|screenshot)[\s_-]*\d[\d\s_-]*$`)
+	symbolAltPattern  = regexp.MustCompile(`^[^\pL\pN]+$`)
+)
+
+// ParseAltPolicy parses a policy name like "missing-only".
+func ParseAltPolicy(name string) (AltPolicy, error) {
+	for policy, policyName := range altPolicyNames {
+		if policyName == name {
+			return policy, nil
+		}
+	}
+
+	return MissingOnly, &AltPolicyError{name}
+}
+
+func (p AltPolicy) String() string {
+	return altPolicyNames[p]
+}
+
+// ShouldLabel reports whether an image with this src and alt should get a new alt.
+func (p AltPolicy) ShouldLabel(src string, alt string, hasAlt bool) bool {
+	if !hasAlt {
+		return true
+	}
+
+	switch p {
+	case EmptyOnly:
+		return strings.TrimSpace(alt) == ""
+	case Overwrite:
+		return true
+	case LowQuality:
+		return IsLowQuality(src, alt)
+	default:
+		return false
+	}
+}
+
+// IsLowQuality checks if an alt is junk: blank, a filename, or a generic word
+// like "image" or "IMG_1234".
+func IsLowQuality(src string, alt string) bool {
+	alt = strings.TrimSpace(alt)
+
+	if alt == "" {
+		return true
+	}
+
+	return IsFileName(src, alt) ||
+		genericAltPattern.MatchString(alt) ||
+		cameraAltPattern.MatchString(alt) ||
+		symbolAltPattern.MatchString(alt)
+}
+
+// IsFileName checks if an alt is just a filename, like the image's own name
+// with or without its extension, or anything ending in an image extension.
+func IsFileName(src string, alt string) bool {
+	alt = strings.TrimSpace(alt)
+
+	if alt == "" {
+		return false
+	}
+
+	base := path.Base(src)
+
+	if strings.EqualFold(alt, base) || strings.EqualFold(alt, strings.TrimSuffix(base, path.Ext(base))) {
+		return true
+	}
+
+	return imageExtPattern.MatchString(alt)
+}
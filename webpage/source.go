@@ -0,0 +1,205 @@
+package webpage
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// lazySrcAttrs are attributes lazy-loading scripts use for the real src.
+var lazySrcAttrs = []string{"data-src", "data-lazy-src", "data-original"}
+
+// srcsetAttrs are attributes holding a list of responsive candidates.
+var srcsetAttrs = []string{"srcset", "data-srcset", "data-lazy-srcset"}
+
+// candidate is one entry of a srcset, like "cat-640.png 640w".
+type candidate struct {
+	url     string
+	width   int
+	density float64
+}
+
+// parseSrcset splits a srcset into candidates. Candidates without a
+// descriptor are "1x".
+func parseSrcset(srcset string) []candidate {
+	candidates := []candidate{}
+
+	i := 0
+
+	for i < len(srcset) {
+		for i < len(srcset) && (isSpace(srcset[i]) || srcset[i] == ',') {
+			i++
+		}
+
+		urlStart := i
+
+		for i < len(srcset) && !isSpace(srcset[i]) {
+			i++
+		}
+
+		url := srcset[urlStart:i]
+
+		// a url ending in commas has no descriptors
+		descriptors := ""
+
+		if strings.HasSuffix(url, ",") {
+			url = strings.TrimRight(url, ",")
+		} else {
+			descStart := i
+			depth := 0
+
+			for i < len(srcset) && (srcset[i] != ',' || depth > 0) {
+				switch srcset[i] {
+				case '(':
+					depth++
+				case ')':
+					depth--
+				}
+				i++
+			}
+
+			descriptors = srcset[descStart:i]
+		}
+
+		if url == "" {
+			continue
+		}
+
+		c := candidate{url: url, density: 1}
+
+		for _, descriptor := range strings.Fields(descriptors) {
+			value := descriptor[:len(descriptor)-1]
+
+			switch descriptor[len(descriptor)-1] {
+			case 'w':
+				if width, err := strconv.Atoi(value); err == nil {
+					c.width = width
+				}
+			case 'x':
+				if density, err := strconv.ParseFloat(value, 64); err == nil {
+					c.density = density
+				}
+			}
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	return candidates
+}
+
+// better checks if a is a larger image than b. Widths beat densities since
+// they say more about the actual file.
+func (a candidate) better(b candidate) bool {
+	if a.width > 0 || b.width > 0 {
+		return a.width > b.width
+	}
+
+	return a.density > b.density
+}
+
+// srcsetCandidates collects the srcset candidates of an image node and, if it
+// is in a <picture>, those of its <source> siblings.
+func srcsetCandidates(n *html.Node) []candidate {
+	nodes := []*html.Node{n}
+
+	if n.Parent != nil && n.Parent.DataAtom == atom.Picture {
+		for sibling := n.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+			if sibling.Type == html.ElementNode && sibling.DataAtom == atom.Source {
+				nodes = append(nodes, sibling)
+			}
+		}
+	}
+
+	candidates := []candidate{}
+
+	for _, node := range nodes {
+		for _, key := range srcsetAttrs {
+			if srcset, ok := getAttr(node.Attr, key); ok {
+				candidates = append(candidates, parseSrcset(srcset)...)
+			}
+		}
+	}
+
+	return candidates
+}
+
+// imageSource picks the best source to caption for an image node: the largest
+// srcset candidate, then any lazy-loading attribute, then src.
+func imageSource(n *html.Node) string {
+	var best *candidate
+
+	for _, c := range srcsetCandidates(n) {
+		c := c
+
+		if best == nil || c.better(*best) {
+			best = &c
+		}
+	}
+
+	if best != nil {
+		return best.url
+	}
+
+	for _, key := range lazySrcAttrs {
+		if src, ok := getAttr(n.Attr, key); ok && strings.TrimSpace(src) != "" {
+			return strings.TrimSpace(src)
+		}
+	}
+
+	src, _ := getAttr(n.Attr, "src")
+
+	return strings.TrimSpace(src)
+}
+
+// baseHref returns the href of the first <base> in inputHTML, which relative
+// image references resolve against.
+func baseHref(inputHTML string) string {
+	z := html.NewTokenizer(strings.NewReader(inputHTML))
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+
+			if token.DataAtom != atom.Base {
+				continue
+			}
+
+			if href, ok := getAttr(token.Attr, "href"); ok {
+				return href
+			}
+		}
+	}
+}
+
+// pageLanguage returns the lang (or xml:lang) of the <html> in inputHTML.
+func pageLanguage(inputHTML string) string {
+	z := html.NewTokenizer(strings.NewReader(inputHTML))
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+
+			if token.DataAtom != atom.Html {
+				// <html> can only be preceded by comments and a doctype
+				return ""
+			}
+
+			if lang, ok := getAttr(token.Attr, "lang"); ok && strings.TrimSpace(lang) != "" {
+				return strings.TrimSpace(lang)
+			}
+
+			lang, _ := getAttr(token.Attr, "xml:lang")
+
+			return strings.TrimSpace(lang)
+		}
+	}
+}
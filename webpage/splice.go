@@ -0,0 +1,296 @@
+package webpage
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// rawAttr is the location of an attribute within the raw bytes of a tag.
+type rawAttr struct {
+	key        string
+	start, end int
+	valStart   int
+	valEnd     int
+	hasVal     bool
+	quote      byte
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\t' || c == '\f' || c == '\r'
+}
+
+// scanTag finds every attribute in a raw start tag like `<img src="a.png">`.
+// It also returns where the tag name or last attribute ends, which is where a
+// new attribute can be inserted.
+func scanTag(raw string) ([]rawAttr, int) {
+	attrs := []rawAttr{}
+
+	i := 1 // skip '<'
+
+	for i < len(raw) && !isSpace(raw[i]) && raw[i] != '/' && raw[i] != '>' {
+		i++
+	}
+
+	lastEnd := i
+
+	for i < len(raw) {
+		for i < len(raw) && (isSpace(raw[i]) || raw[i] == '/') {
+			i++
+		}
+
+		if i >= len(raw) || raw[i] == '>' {
+			break
+		}
+
+		attr := rawAttr{start: i}
+
+		// an '=' at the start of a name is part of the name
+		i++
+
+		for i < len(raw) && !isSpace(raw[i]) && raw[i] != '/' && raw[i] != '>' && raw[i] != '=' {
+			i++
+		}
+
+		attr.key = strings.ToLower(raw[attr.start:i])
+		attr.end = i
+
+		j := i
+
+		for j < len(raw) && isSpace(raw[j]) {
+			j++
+		}
+
+		if j < len(raw) && raw[j] == '=' {
+			j++
+
+			for j < len(raw) && isSpace(raw[j]) {
+				j++
+			}
+
+			attr.hasVal = true
+
+			if j < len(raw) && (raw[j] == '"' || raw[j] == '\'') {
+				attr.quote = raw[j]
+				attr.valStart = j + 1
+				attr.valEnd = attr.valStart
+
+				for attr.valEnd < len(raw) && raw[attr.valEnd] != attr.quote {
+					attr.valEnd++
+				}
+
+				i = attr.valEnd + 1
+			} else {
+				attr.valStart = j
+				attr.valEnd = j
+
+				for attr.valEnd < len(raw) && !isSpace(raw[attr.valEnd]) && raw[attr.valEnd] != '>' {
+					attr.valEnd++
+				}
+
+				i = attr.valEnd
+			}
+
+			if i > len(raw) {
+				i = len(raw)
+			}
+
+			attr.end = i
+		}
+
+		attrs = append(attrs, attr)
+		lastEnd = attr.end
+	}
+
+	return attrs, lastEnd
+}
+
+// setRawAttr sets an attribute in a raw start tag, changing no other bytes.
+func setRawAttr(raw string, key string, val string) string {
+	attrs, lastEnd := scanTag(raw)
+	escaped := html.EscapeString(val)
+
+	for _, attr := range attrs {
+		if attr.key != key {
+			continue
+		}
+
+		switch {
+		case !attr.hasVal:
+			return raw[:attr.start] + key + "=\"" + escaped + "\"" + raw[attr.end:]
+		case attr.quote == 0:
+			return raw[:attr.valStart] + "\"" + escaped + "\"" + raw[attr.valEnd:]
+		default:
+			return raw[:attr.valStart] + escaped + raw[attr.valEnd:]
+		}
+	}
+
+	return raw[:lastEnd] + " " + key + "=\"" + escaped + "\"" + raw[lastEnd:]
+}
+
+// imageNodes lists every image node under n in document order.
+func imageNodes(n *html.Node) []*html.Node {
+	nodes := []*html.Node{}
+
+	if n.Type == html.ElementNode && (n.DataAtom == atom.Img || n.DataAtom == atom.Image) {
+		nodes = append(nodes, n)
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		nodes = append(nodes, imageNodes(child)...)
+	}
+
+	return nodes
+}
+
+func getAttr(attrs []html.Attribute, key string) (string, bool) {
+	for _, a := range attrs {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+
+	return "", false
+}
+
+// sameAttrs checks if two attribute lists match, ignoring alt.
+func sameAttrs(a []html.Attribute, b []html.Attribute) bool {
+	i, j := 0, 0
+
+	for {
+		for i < len(a) && a[i].Key == "alt" {
+			i++
+		}
+
+		for j < len(b) && b[j].Key == "alt" {
+			j++
+		}
+
+		if i == len(a) || j == len(b) {
+			return i == len(a) && j == len(b)
+		}
+
+		if a[i].Key != b[j].Key || a[i].Val != b[j].Val {
+			return false
+		}
+
+		i++
+		j++
+	}
+}
+
+// Position is where something starts in a document. Lines and columns start
+// at 1, and columns count characters, not bytes. The zero Position is unknown.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Positions finds the Position of byte offsets in a document. Finding them
+// in order goes through the document only once.
+type Positions struct {
+	doc      string
+	offset   int
+	position Position
+}
+
+// NewPositions returns Positions in doc.
+func NewPositions(doc string) *Positions {
+	return &Positions{doc: doc, position: Position{Line: 1, Column: 1}}
+}
+
+// At returns the Position of offset, counting on from the last offset asked
+// for, or from the start if offset is before it.
+func (p *Positions) At(offset int) Position {
+	if offset > len(p.doc) {
+		offset = len(p.doc)
+	}
+
+	if offset < p.offset {
+		p.offset = 0
+		p.position = Position{Line: 1, Column: 1}
+	}
+
+	for _, r := range p.doc[p.offset:offset] {
+		if r == '\n' {
+			p.position.Line++
+			p.position.Column = 1
+		} else {
+			p.position.Column++
+		}
+	}
+
+	p.offset = offset
+
+	return p.position
+}
+
+// splice copies inputHTML, rewriting only the alt attribute of <img> tags
+// whose node in the parsed tree has a different alt. It also returns the
+// Position of each node's tag.
+//
+// The parser can move nodes around (into or out of tables, for example), so
+// each tag is matched with the first unused node that has the same attributes.
+func splice(inputHTML string, nodes []*html.Node) (string, []Position, error) {
+	used := make([]bool, len(nodes))
+	positions := make([]Position, len(nodes))
+	lines := NewPositions(inputHTML)
+	offset := 0
+
+	var builder strings.Builder
+
+	z := html.NewTokenizer(strings.NewReader(inputHTML))
+
+	for {
+		tokenType := z.Next()
+
+		if tokenType == html.ErrorToken {
+			// keep any unfinished token at the end of the input
+			builder.Write(z.Raw())
+
+			if z.Err() == io.EOF {
+				return builder.String(), positions, nil
+			}
+
+			return "", nil, z.Err()
+		}
+
+		raw := string(z.Raw())
+		start := offset
+		offset += len(raw)
+
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			builder.WriteString(raw)
+			continue
+		}
+
+		token := z.Token()
+
+		if token.Data != "img" && token.Data != "image" {
+			builder.WriteString(raw)
+			continue
+		}
+
+		for i, n := range nodes {
+			if used[i] || !sameAttrs(n.Attr, token.Attr) {
+				continue
+			}
+
+			used[i] = true
+			positions[i] = lines.At(start)
+
+			newAlt, hasNewAlt := getAttr(n.Attr, "alt")
+			oldAlt, hasOldAlt := getAttr(token.Attr, "alt")
+
+			if hasNewAlt && (!hasOldAlt || oldAlt != newAlt) {
+				raw = setRawAttr(raw, "alt", newAlt)
+			}
+
+			break
+		}
+
+		builder.WriteString(raw)
+	}
+}
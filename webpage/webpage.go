@@ -1,8 +1,6 @@
 package webpage
 
 import (
-	"bytes"
-	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -10,7 +8,8 @@ import (
 
 	"github.com/samuelstevens/gocaption/api"
 	"github.com/samuelstevens/gocaption/caption"
-	"github.com/samuelstevens/gocaption/util"
+	"github.com/samuelstevens/gocaption/diff"
+	"github.com/samuelstevens/gocaption/filetype"
 
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
@@ -20,15 +19,44 @@ import (
 // tags updated with an "alt" attribute
 type WebPage struct {
 	absolutePath string
+	xhtml        bool
+	original     string
 	content      string
+	changes      int
 	Captions     []*caption.Caption
+	Policy       AltPolicy
+	Resolver     *caption.Resolver
+	// Language is what to caption images in if the page has no <html lang>.
+	Language    string
+	occurrences []Occurrence
 }
 
+// LabelFunc returns a new alt for an image, or "" to leave it alone.
 type LabelFunc func(imgPath string, prevDescription string) string
 
+// SkipFunc is told about every image that is left alone without asking the
+// LabelFunc, along with why, like SkipDecorative.
+type SkipFunc func(imgPath string, alt string, reason string)
+
+// Why an image was left alone without being captioned.
+const (
+	// SkipIgnored images follow a gocaption:ignore-next comment or are
+	// between gocaption:off and gocaption:on.
+	SkipIgnored = "ignored"
+	// SkipOptedOut images are marked data-gocaption="skip".
+	SkipOptedOut = "opted-out"
+	// SkipDecorative images have alt="", role="presentation" or "none", or
+	// aria-hidden="true".
+	SkipDecorative = "decorative"
+	// SkipHasAlt images have an alt the AltPolicy keeps.
+	SkipHasAlt = "has-alt"
+)
+
 // New returns a new WebPage
 func New(path string) (*WebPage, error) {
-	if filepath.Ext(path) != ".html" {
+	fileType := filetype.Detect(path)
+
+	if fileType != filetype.HTML && fileType != filetype.XHTML {
 		return nil, &FileTypeError{path}
 	}
 
@@ -40,113 +68,362 @@ func New(path string) (*WebPage, error) {
 
 	return &WebPage{
 		absolutePath: path,
+		xhtml:        fileType == filetype.XHTML,
 		content:      "",
 		Captions:     []*caption.Caption{},
 	}, nil
 }
 
+// Path returns the absolute path of the WebPage.
+func (wp *WebPage) Path() string {
+	return wp.absolutePath
+}
+
+// Write saves the labeled document if anything changed.
 func (wp *WebPage) Write() error {
+	if wp.content == wp.original {
+		return nil
+	}
+
 	return ioutil.WriteFile(wp.absolutePath, []byte(wp.content), 0644)
 }
 
-func renderNode(n *html.Node) string {
-	var buf bytes.Buffer
-	w := io.Writer(&buf)
-	html.Render(w, n)
-	return buf.String()
+// Diff returns a unified diff of what Write would change.
+func (wp *WebPage) Diff() string {
+	return diff.Unified("a"+wp.absolutePath, "b"+wp.absolutePath, wp.original, wp.content)
 }
 
-// LabelNode recursively searches through an html node
-// and adds an attribute to any image nodes it finds
-func LabelNode(n *html.Node, labelFunc LabelFunc) {
+// Changes returns how many images would gain or change an alt.
+func (wp *WebPage) Changes() int {
+	return wp.changes
+}
+
+// Occurrences lists every image in the page, in order, and what the last
+// call to Caption did with it.
+func (wp *WebPage) Occurrences() []Occurrence {
+	return wp.occurrences
+}
+
+// LabelNode recursively searches through an html node and, for any image
+// nodes the policy allows, sets the alt attribute. An alt is never replaced by
+// an empty string.
+//
+// The image captioned is the largest candidate from a srcset (including the
+// <source>s of a <picture>), then a lazy-loading attribute like data-src,
+// then src.
+//
+// Decorative images (alt="", role="presentation" or "none", aria-hidden="true")
+// and images marked data-gocaption="skip" are left alone, as are images after
+// a <!-- gocaption:ignore-next --> comment or between <!-- gocaption:off -->
+// and <!-- gocaption:on -->.
+func LabelNode(n *html.Node, policy AltPolicy, labelFunc LabelFunc) {
+	LabelNodeSkipping(n, policy, labelFunc, nil)
+}
+
+// LabelNodeSkipping is like LabelNode, but tells skipFunc about every image
+// it leaves alone. skipFunc may be nil.
+func LabelNodeSkipping(n *html.Node, policy AltPolicy, labelFunc LabelFunc, skipFunc SkipFunc) {
+	l := labeler{policy: policy, labelFunc: labelFunc, skipFunc: skipFunc, directives: &Directives{}}
+	l.label(n)
+}
+
+// VisitFunc is told about every element Walk reaches, along with why it would
+// be left alone, like SkipIgnored, or "" if it wouldn't be.
+type VisitFunc func(n *html.Node, skipped string)
+
+// Walk goes through an html node like LabelNode, but only tells visitFunc
+// about every element instead of labeling images. Only images get skip
+// reasons besides SkipIgnored.
+func Walk(n *html.Node, policy AltPolicy, visitFunc VisitFunc) {
+	l := labeler{policy: policy, visitFunc: visitFunc, directives: &Directives{}}
+	l.label(n)
+}
+
+// labeler keeps track of comment directives while labeling a document.
+type labeler struct {
+	policy     AltPolicy
+	labelFunc  LabelFunc
+	skipFunc   SkipFunc
+	visitFunc  VisitFunc
+	directives *Directives
+}
+
+func (l *labeler) label(n *html.Node) {
 
 	switch n.Type {
+	case html.CommentNode:
+		l.directives.Comment(n.Data)
+
 	case html.DocumentNode, html.ElementNode:
-		if n.DataAtom == atom.Img || n.DataAtom == atom.Image {
-			var imgSrc, imgAlt string
+		switch {
+		case n.DataAtom == atom.Img || n.DataAtom == atom.Image:
+			l.labelImage(n)
+		case n.Type == html.ElementNode && l.visitFunc != nil:
+			if l.directives.Off() {
+				l.visitFunc(n, SkipIgnored)
+			} else {
+				l.visitFunc(n, "")
+			}
+		}
 
-			for _, a := range n.Attr {
-				if a.Key == "src" {
-					imgSrc = a.Val
-				}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			l.label(child)
+		}
+	}
+}
 
-				if a.Key == "alt" {
-					imgAlt = a.Val
-				}
-			}
+func (l *labeler) labelImage(n *html.Node) {
+	imgSrc := imageSource(n)
+	imgAlt, hasAlt := getAttr(n.Attr, "alt")
 
-			caption := labelFunc(imgSrc, imgAlt)
-			newAlt := html.Attribute{Key: "alt", Val: caption}
-			newAttr := []html.Attribute{newAlt}
+	reason := l.skipReason(n, imgSrc, imgAlt, hasAlt)
 
-			for _, a := range n.Attr {
-				if a.Key != "alt" {
-					newAttr = append(newAttr, a)
-				}
-			}
+	if l.visitFunc != nil {
+		l.visitFunc(n, reason)
+		return
+	}
 
-			n.Attr = newAttr
+	if reason != "" {
+		if l.skipFunc != nil {
+			l.skipFunc(imgSrc, imgAlt, reason)
 		}
 
-		for child := n.FirstChild; child != nil; child = child.NextSibling {
-			LabelNode(child, labelFunc)
+		return
+	}
+
+	if caption := l.labelFunc(imgSrc, imgAlt); caption != "" {
+		n.Attr = setAttr(n.Attr, "alt", caption)
+	}
+}
+
+// skipReason is why an image should be left alone, or "" to label it.
+func (l *labeler) skipReason(n *html.Node, imgSrc string, imgAlt string, hasAlt bool) string {
+	if l.directives.Ignore() {
+		return SkipIgnored
+	}
+
+	switch {
+	case optedOut(n):
+		return SkipOptedOut
+	case decorative(n, l.policy):
+		return SkipDecorative
+	case !l.policy.ShouldLabel(imgSrc, imgAlt, hasAlt):
+		return SkipHasAlt
+	}
+
+	return ""
+}
+
+// setAttr sets an attribute, keeping its position if it already exists.
+func setAttr(attrs []html.Attribute, key string, val string) []html.Attribute {
+	for i, a := range attrs {
+		if a.Key == key {
+			attrs[i].Val = val
+			return attrs
 		}
 	}
+
+	return append(attrs, html.Attribute{Key: key, Val: val})
 }
 
-// LabelImages takes an unescaped HTML string and returns a new string containing labeled images
-func LabelImages(inputHTML string, labelFunc LabelFunc) (string, error) {
+// LabelImages takes an unescaped HTML string and returns a new string containing labeled images.
+// Only the alt attributes of images are changed; every other byte is left as it was.
+func LabelImages(inputHTML string, policy AltPolicy, labelFunc LabelFunc) (string, error) {
+	return LabelImagesSkipping(inputHTML, policy, labelFunc, nil)
+}
+
+// LabelImagesSkipping is like LabelImages, but tells skipFunc about every
+// image it leaves alone. skipFunc may be nil.
+func LabelImagesSkipping(inputHTML string, policy AltPolicy, labelFunc LabelFunc, skipFunc SkipFunc) (string, error) {
+	labeled, _, err := labelImages(inputHTML, &Directives{}, policy, labelFunc, skipFunc)
+
+	return labeled, err
+}
+
+// LabelImagesFollowing is like LabelImagesSkipping, for HTML that is part of a
+// bigger document. It starts with the directives of the comments before the
+// HTML, and updates them with the ones in it.
+func LabelImagesFollowing(inputHTML string, directives *Directives, policy AltPolicy, labelFunc LabelFunc, skipFunc SkipFunc) (string, error) {
+	labeled, _, err := labelImages(inputHTML, directives, policy, labelFunc, skipFunc)
+
+	return labeled, err
+}
+
+// labelImages is LabelImagesFollowing, but also returns the Position of every
+// image, in the order labelFunc or skipFunc was called for them.
+func labelImages(inputHTML string, directives *Directives, policy AltPolicy, labelFunc LabelFunc, skipFunc SkipFunc) (string, []Position, error) {
 	doc, err := html.Parse(strings.NewReader(inputHTML))
 
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	LabelNode(doc, labelFunc)
+	l := labeler{policy: policy, labelFunc: labelFunc, skipFunc: skipFunc, directives: directives}
+	l.label(doc)
 
-	return renderNode(doc), nil
+	return splice(inputHTML, imageNodes(doc))
 }
 
-// LabelImages takes all the <img> in an .html document and adds
-// an "alt" attribute if it is missing.
-func (wp *WebPage) LabelImages(client *api.Client) error {
+// Image is an <img> in a WebPage that could be resolved to a caption.Source.
+type Image struct {
+	Source      caption.Source
+	Description string
+	// Language is what the image should be captioned in.
+	Language string
+}
+
+// Occurrence is an image in a document and what captioning did with it.
+type Occurrence struct {
+	// Src is the image as the document refers to it, like "img/cat.png".
+	Src string
+	// Source is what Src resolved to, or nil if it wasn't resolved.
+	Source caption.Source
+	// PrevDescription is the image's alt before captioning.
+	PrevDescription string
+	// Caption is the image's caption, or nil if it wasn't captioned.
+	Caption *caption.Caption
+	// Skipped is why the image was left alone, like SkipDecorative.
+	Skipped string
+	// Err is why resolving or captioning the image failed.
+	Err error
+	// Position is where the image is in the document.
+	Position Position
+}
+
+// CaptionFunc captions an image in a language.
+type CaptionFunc func(source caption.Source, prevDescription string, language string) (*caption.Caption, error)
+
+// language is what to caption a page's images in: its <html lang>, or else
+// the WebPage's Language.
+func (wp *WebPage) language(rawDoc string) string {
+	if lang := pageLanguage(rawDoc); lang != "" {
+		return lang
+	}
 
+	return wp.Language
+}
+
+func (wp *WebPage) read() (string, error) {
 	file, err := os.Open(wp.absolutePath)
 
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	defer file.Close()
 
 	rawDoc, err := ioutil.ReadAll(file)
 
+	if err != nil {
+		return "", err
+	}
+
+	return string(rawDoc), nil
+}
+
+// Images lists every <img> in an .html document that the WebPage's Policy
+// allows labeling and whose source can be resolved.
+func (wp *WebPage) Images() ([]Image, error) {
+	rawDoc, err := wp.read()
+
+	if err != nil {
+		return nil, err
+	}
+
+	images := []Image{}
+	base := baseHref(rawDoc)
+	language := wp.language(rawDoc)
+
+	_, err = LabelImages(rawDoc, wp.Policy, func(relativeImgPath string, prevDescription string) string {
+		source, err := wp.Resolver.ResolveBase(wp.absolutePath, base, relativeImgPath)
+
+		if err == nil {
+			images = append(images, Image{source, prevDescription, language})
+		}
+
+		return ""
+	})
+
+	return images, err
+}
+
+// LabelImages takes all the <img> in an .html document and adds
+// an "alt" attribute if it is missing.
+func (wp *WebPage) LabelImages(describer api.Describer) error {
+	return wp.Caption(func(source caption.Source, prevDescription string, language string) (*caption.Caption, error) {
+		return caption.New(source, prevDescription, language, describer)
+	})
+}
+
+// Caption is like LabelImages, but gets each caption from captionFunc.
+func (wp *WebPage) Caption(captionFunc CaptionFunc) error {
+	rawDoc, err := wp.read()
+
 	if err != nil {
 		return err
 	}
 
-	updatedDoc, err := LabelImages(string(rawDoc), func(relativeImgPath string, prevDescription string) string {
-		absImgPath, err := util.MakeAbsRelativeTo(wp.absolutePath, relativeImgPath)
+	wp.changes = 0
+	wp.occurrences = []Occurrence{}
+	base := baseHref(rawDoc)
+	language := wp.language(rawDoc)
+
+	labelFunc := func(relativeImgPath string, prevDescription string) string {
+		occurrence := Occurrence{Src: relativeImgPath, PrevDescription: prevDescription}
+
+		defer func() {
+			wp.occurrences = append(wp.occurrences, occurrence)
+		}()
+
+		source, err := wp.Resolver.ResolveBase(wp.absolutePath, base, relativeImgPath)
 
 		if err != nil {
+			occurrence.Err = err
 			return ""
 		}
 
-		caption, err := caption.New(absImgPath, prevDescription, client)
+		occurrence.Source = source
+
+		// the policy already decided prevDescription should be replaced
+		caption, err := captionFunc(source, "", language)
 
 		if err != nil {
+			occurrence.Err = err
 			return ""
 		}
 
+		occurrence.Caption = caption
 		wp.Captions = append(wp.Captions, caption)
 
+		if caption.Description != "" && caption.Description != prevDescription {
+			wp.changes++
+		}
+
 		return caption.Description
-	})
+	}
+
+	skipFunc := func(relativeImgPath string, alt string, reason string) {
+		wp.occurrences = append(wp.occurrences, Occurrence{Src: relativeImgPath, PrevDescription: alt, Skipped: reason})
+	}
+
+	updatedDoc, positions, err := labelImages(rawDoc, &Directives{}, wp.Policy, labelFunc, skipFunc)
 
 	if err != nil {
 		return err
 	}
 
+	// every image gets exactly one occurrence, in document order
+	for i := range wp.occurrences {
+		wp.occurrences[i].Position = positions[i]
+	}
+
+	if wp.xhtml {
+		if err := checkXML(rawDoc, updatedDoc); err != nil {
+			return err
+		}
+	}
+
+	wp.original = rawDoc
 	wp.content = updatedDoc
 
 	return nil
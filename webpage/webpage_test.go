@@ -1,8 +1,13 @@
 package webpage
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/samuelstevens/gocaption/caption"
 )
 
 func TestNewWebPage(t *testing.T) {
@@ -18,6 +23,16 @@ func TestNewWebPage(t *testing.T) {
 			wantedPath: "./test.html",
 			err:        nil,
 		},
+		{
+			path:       "./test.HTM",
+			wantedPath: "./test.HTM",
+			err:        nil,
+		},
+		{
+			path:       "./test.xhtml",
+			wantedPath: "./test.xhtml",
+			err:        nil,
+		},
 		{
 			path:       "./test.go",
 			wantedPath: "",
@@ -64,11 +79,27 @@ func TestLabelImages(t *testing.T) {
 		},
 		{
 			html: "<img src=\"hello.png\" />",
-			want: "<img alt=\"hello, world!\" src=\"hello.png\"/>",
+			want: "<img src=\"hello.png\" alt=\"hello, world!\" />",
 		},
 		{
 			html: "<img src=\"hello.png\" alt=\"hello, world!\"/>",
-			want: "<img alt=\"hello, world!\" src=\"hello.png\"/>",
+			want: "<img src=\"hello.png\" alt=\"hello, world!\"/>",
+		},
+		{
+			html: "<IMG SRC='hello.png' ALT='old' class=big>",
+			want: "<IMG SRC='hello.png' ALT='hello, world!' class=big>",
+		},
+		{
+			html: "<img src=hello.png alt=old>",
+			want: "<img src=hello.png alt=\"hello, world!\">",
+		},
+		{
+			html: "<img hidden src=\"a&amp;b.png\">",
+			want: "<img hidden src=\"a&amp;b.png\" alt=\"hello, world!\">",
+		},
+		{
+			html: "<img src=hello/>",
+			want: "<img src=hello/ alt=\"hello, world!\">",
 		},
 		{
 			html: "<script>var x = \"hello\"</script>",
@@ -80,7 +111,7 @@ func TestLabelImages(t *testing.T) {
 		html := preHTML + c.html + postHTML
 		want := preHTML + c.want + postHTML
 
-		got, err := LabelImages(html, labelFunc)
+		got, err := LabelImages(html, Overwrite, labelFunc)
 
 		if err != nil {
 
@@ -94,3 +125,438 @@ func TestLabelImages(t *testing.T) {
 
 	}
 }
+
+func TestSetRawAttr(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want string
+	}{
+		{raw: "<img>", want: "<img alt=\"x\">"},
+		{raw: "<img/>", want: "<img alt=\"x\"/>"},
+		{raw: "<img alt src=a>", want: "<img alt=\"x\" src=a>"},
+		{raw: "<img ALT = 'y' >", want: "<img ALT = 'x' >"},
+		{raw: "<img src=\"a.png\"\n  class=c\n/>", want: "<img src=\"a.png\"\n  class=c alt=\"x\"\n/>"},
+	}
+
+	for _, c := range cases {
+		if got := setRawAttr(c.raw, "alt", "x"); got != c.want {
+			t.Errorf("setRawAttr(%q) = %q; want %q", c.raw, got, c.want)
+		}
+	}
+}
+
+func TestLabelImagesPreservesFormatting(t *testing.T) {
+	var labelFunc LabelFunc = func(imgPath string, prevDescription string) string {
+		return "a \"quoted\" & <odd> caption"
+	}
+
+	cases := []struct {
+		html string
+		want string
+	}{
+		{
+			html: "<p>Fragment &copy; <b>with</b> no body",
+			want: "<p>Fragment &copy; <b>with</b> no body",
+		},
+		{
+			html: "<!DOCTYPE html>\n<div\n  class=\"x\"   id=y>\n\t<img\n\tsrc=\"a.png\"\n/>\n</div>",
+			want: "<!DOCTYPE html>\n<div\n  class=\"x\"   id=y>\n\t<img\n\tsrc=\"a.png\" alt=\"a &#34;quoted&#34; &amp; &lt;odd&gt; caption\"\n/>\n</div>",
+		},
+		{
+			html: "<script>document.write('<img src=\"a.png\">')</script><noscript><img src=\"b.png\"></noscript>",
+			want: "<script>document.write('<img src=\"a.png\">')</script><noscript><img src=\"b.png\"></noscript>",
+		},
+		{
+			html: "<table><tr><td><img src=\"a.png\"></td></tr><img src=\"b.png\"></table>",
+			want: "<table><tr><td><img src=\"a.png\" alt=\"a &#34;quoted&#34; &amp; &lt;odd&gt; caption\"></td></tr><img src=\"b.png\" alt=\"a &#34;quoted&#34; &amp; &lt;odd&gt; caption\"></table>",
+		},
+		{
+			html: "<p>unfinished <img src=\"a.png",
+			want: "<p>unfinished <img src=\"a.png",
+		},
+	}
+
+	for _, c := range cases {
+		got, err := LabelImages(c.html, Overwrite, labelFunc)
+
+		if err != nil {
+			t.Errorf("got error %s; wanted no error", err.Error())
+		}
+
+		if got != c.want {
+			t.Errorf("LabelImages(%q) == %q, want %q", c.html, got, c.want)
+		}
+	}
+}
+
+func writeTestPage(t *testing.T, contents string) (string, *WebPage) {
+	return writeTestFile(t, "index.html", contents)
+}
+
+func writeTestFile(t *testing.T, name string, contents string) (string, *WebPage) {
+	dir, err := ioutil.TempDir("", "webpage")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "cat.png"), []byte("cat"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, name)
+
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := New(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, page
+}
+
+func TestCaptionSources(t *testing.T) {
+	dir, page := writeTestPage(t, `<img src="data:image/png;base64,Y2F0"><img src="https://example.com/dog.png">`)
+	defer os.RemoveAll(dir)
+
+	names := []string{}
+
+	err := page.Caption(func(source caption.Source, prevDescription string, language string) (*caption.Caption, error) {
+		names = append(names, source.Name())
+		return &caption.Caption{FilePath: source.Name(), Description: "a cat"}, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// remote images are skipped without a Fetcher
+	if len(names) != 1 || !strings.HasPrefix(names[0], "data:image/png;sha1=") {
+		t.Errorf("captioned %v, want only the data URI", names)
+	}
+}
+
+func TestCaptionChanges(t *testing.T) {
+	dir, page := writeTestPage(t, "<html><head></head><body>\n<img src=\"cat.png\"/>\n</body></html>")
+	defer os.RemoveAll(dir)
+
+	err := page.Caption(func(source caption.Source, prevDescription string, language string) (*caption.Caption, error) {
+		return &caption.Caption{FilePath: source.Name(), Description: "a cat"}, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if page.Changes() != 1 {
+		t.Errorf("got %d changes, want 1", page.Changes())
+	}
+
+	want := "--- a" + page.Path() + "\n+++ b" + page.Path() + "\n" +
+		"@@ -1,3 +1,3 @@\n <html><head></head><body>\n-<img src=\"cat.png\"/>\n+<img src=\"cat.png\" alt=\"a cat\"/>\n </body></html>\n" +
+		"\\ No newline at end of file\n"
+
+	if got := page.Diff(); got != want {
+		t.Errorf("Diff() = %q; want %q", got, want)
+	}
+}
+
+func TestCaptionOccurrences(t *testing.T) {
+	dir, page := writeTestPage(t, "<p>\n  <img src=\"data:,cat\"> <img src=\"dog.png\" alt=\"my dog\">\n<table><td>é <img src=\"missing.png\"></table>")
+	defer os.RemoveAll(dir)
+
+	err := page.Caption(func(source caption.Source, prevDescription string, language string) (*caption.Caption, error) {
+		return &caption.Caption{FilePath: source.Name(), Description: "a cat"}, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	occurrences := page.Occurrences()
+
+	if len(occurrences) != 3 {
+		t.Fatalf("got %d occurrences, want 3", len(occurrences))
+	}
+
+	if occurrences[0].Caption == nil || occurrences[1].Skipped != SkipHasAlt || occurrences[2].Err == nil {
+		t.Errorf("got occurrences %+v", occurrences)
+	}
+
+	for i, want := range []Position{{2, 3}, {2, 25}, {3, 14}} {
+		if occurrences[i].Position != want {
+			t.Errorf("%s is at %+v, want %+v", occurrences[i].Src, occurrences[i].Position, want)
+		}
+	}
+}
+
+func TestLabelImagesPolicy(t *testing.T) {
+	var labelFunc LabelFunc = func(imgPath string, prevDescription string) string {
+		if imgPath == "missing.png" {
+			return ""
+		}
+
+		return "a cat"
+	}
+
+	cases := []struct {
+		policy AltPolicy
+		html   string
+		want   string
+	}{
+		{
+			policy: MissingOnly,
+			html:   `<img src="cat.png"><img src="cat.png" alt=""><img src="cat.png" alt="Whiskers">`,
+			want:   `<img src="cat.png" alt="a cat"><img src="cat.png" alt=""><img src="cat.png" alt="Whiskers">`,
+		},
+		{
+			policy: EmptyOnly,
+			html:   `<img src="cat.png"><img src="cat.png" alt=" "><img src="cat.png" alt="Whiskers">`,
+			want:   `<img src="cat.png" alt="a cat"><img src="cat.png" alt="a cat"><img src="cat.png" alt="Whiskers">`,
+		},
+		{
+			policy: Overwrite,
+			html:   `<img src="cat.png" alt="Whiskers"><img src="missing.png" alt="A mouse">`,
+			want:   `<img src="cat.png" alt="a cat"><img src="missing.png" alt="A mouse">`,
+		},
+		{
+			policy: LowQuality,
+			html:   `<img src="cat.png" alt="cat.png"><img src="cat.png" alt="IMG_1234"><img src="cat.png" alt="Photo"><img src="cat.png" alt="Whiskers asleep">`,
+			want:   `<img src="cat.png" alt="a cat"><img src="cat.png" alt="a cat"><img src="cat.png" alt="a cat"><img src="cat.png" alt="Whiskers asleep">`,
+		},
+		{
+			policy: LowQuality,
+			html:   `<img src="cat.png" alt="猫の写真"><img src="cat.png" alt="Фото кота"><img src="cat.png" alt="—">`,
+			want:   `<img src="cat.png" alt="猫の写真"><img src="cat.png" alt="Фото кота"><img src="cat.png" alt="a cat">`,
+		},
+		{
+			policy: MissingOnly,
+			html:   `<img src="missing.png">`,
+			want:   `<img src="missing.png">`,
+		},
+	}
+
+	for _, c := range cases {
+		got, err := LabelImages(c.html, c.policy, labelFunc)
+
+		if err != nil {
+			t.Errorf("got error %s; wanted no error", err.Error())
+		}
+
+		if got != c.want {
+			t.Errorf("LabelImages(%s, %s) == %s, want %s", c.html, c.policy, got, c.want)
+		}
+	}
+}
+
+func TestLabelImagesMarkers(t *testing.T) {
+	var labelFunc LabelFunc = func(imgPath string, prevDescription string) string {
+		return "a cat"
+	}
+
+	cases := []struct {
+		html string
+		want string
+	}{
+		{
+			html: `<img src="a.png" alt=""><img src="b.png" role="presentation"><img src="c.png" aria-hidden="true"><img src="d.png" data-gocaption="skip">`,
+			want: `<img src="a.png" alt=""><img src="b.png" role="presentation"><img src="c.png" aria-hidden="true"><img src="d.png" data-gocaption="skip">`,
+		},
+		{
+			html: `<!-- gocaption:ignore-next --><p><img src="a.png"></p><img src="b.png">`,
+			want: `<!-- gocaption:ignore-next --><p><img src="a.png"></p><img src="b.png" alt="a cat">`,
+		},
+		{
+			html: `<img src="a.png"><!-- gocaption:off --><img src="b.png"><div><img src="c.png"></div><!--gocaption:on--><img src="d.png">`,
+			want: `<img src="a.png" alt="a cat"><!-- gocaption:off --><img src="b.png"><div><img src="c.png"></div><!--gocaption:on--><img src="d.png" alt="a cat">`,
+		},
+	}
+
+	for _, c := range cases {
+		got, err := LabelImages(c.html, Overwrite, labelFunc)
+
+		if err != nil {
+			t.Errorf("got error %s; wanted no error", err.Error())
+		}
+
+		if got != c.want {
+			t.Errorf("LabelImages(%s) == %s, want %s", c.html, got, c.want)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	doc := "<p>\n  héllo <img>\n<img>"
+	positions := NewPositions(doc)
+
+	cases := []struct {
+		offset int
+		want   Position
+	}{
+		{0, Position{Line: 1, Column: 1}},
+		{strings.Index(doc, "<img>"), Position{Line: 2, Column: 9}},
+		{strings.LastIndex(doc, "<img>"), Position{Line: 3, Column: 1}},
+		{4, Position{Line: 2, Column: 1}},
+		{len(doc) + 10, Position{Line: 3, Column: 6}},
+	}
+
+	for _, c := range cases {
+		if got := positions.At(c.offset); got != c.want {
+			t.Errorf("At(%d) == %+v, want %+v", c.offset, got, c.want)
+		}
+	}
+}
+
+func TestIsLowQuality(t *testing.T) {
+	cases := []struct {
+		src  string
+		alt  string
+		want bool
+	}{
+		{src: "images/cat.png", alt: "cat", want: true},
+		{src: "images/cat.png", alt: "other.JPG", want: true},
+		{src: "cat.png", alt: "image", want: true},
+		{src: "cat.png", alt: "Picture 3", want: true},
+		{src: "cat.png", alt: "DSC_0042", want: true},
+		{src: "cat.png", alt: "---", want: true},
+		{src: "cat.png", alt: "A cat asleep on a keyboard", want: false},
+		{src: "cat.png", alt: "Photo of the 2019 team", want: false},
+		{src: "cat.png", alt: "猫の写真", want: false},
+		{src: "cat.png", alt: "Фото кота", want: false},
+		{src: "cat.png", alt: "★ · ★", want: true},
+	}
+
+	for _, c := range cases {
+		if got := IsLowQuality(c.src, c.alt); got != c.want {
+			t.Errorf("IsLowQuality(%s, %s) = %t; want %t", c.src, c.alt, got, c.want)
+		}
+	}
+}
+
+func TestCaptionXHTML(t *testing.T) {
+	contents := "<?xml version=\"1.0\"?>\n<html xmlns=\"http://www.w3.org/1999/xhtml\"><body><p>&nbsp;<img src=\"cat.png\"/></p></body></html>"
+
+	dir, page := writeTestFile(t, "index.xhtml", contents)
+	defer os.RemoveAll(dir)
+
+	err := page.Caption(func(source caption.Source, prevDescription string, language string) (*caption.Caption, error) {
+		return &caption.Caption{FilePath: source.Name(), Description: "Tom & Jerry's <cat>"}, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wellFormed(page.content); err != nil {
+		t.Errorf("labeled XHTML is not well-formed: %s\n%s", err.Error(), page.content)
+	}
+}
+
+func TestLabelImagesSources(t *testing.T) {
+	var labelFunc LabelFunc = func(imgPath string, prevDescription string) string {
+		return imgPath
+	}
+
+	cases := []struct {
+		html string
+		want string
+	}{
+		{
+			html: `<img src="small.png" srcset="medium.png 640w, large.png 1280w,tiny.png 80w">`,
+			want: `<img src="small.png" srcset="medium.png 640w, large.png 1280w,tiny.png 80w" alt="large.png">`,
+		},
+		{
+			html: `<img src="a.png" srcset="a.png, a@3x.png 3x, a@2x.png 2x">`,
+			want: `<img src="a.png" srcset="a.png, a@3x.png 3x, a@2x.png 2x" alt="a@3x.png">`,
+		},
+		{
+			html: `<img src="data:image/gif;base64,R0lGODlhAQABAAAAACw=" data-src="real.png">`,
+			want: `<img src="data:image/gif;base64,R0lGODlhAQABAAAAACw=" data-src="real.png" alt="real.png">`,
+		},
+		{
+			html: `<img src="placeholder.png" data-lazy-src=" lazy.png ">`,
+			want: `<img src="placeholder.png" data-lazy-src=" lazy.png " alt="lazy.png">`,
+		},
+		{
+			html: `<picture><source srcset="wide.png 1600w, narrow.png 800w" media="(min-width: 800px)"><source srcset="mid.png 1200w"><img src="fallback.png"></picture>`,
+			want: `<picture><source srcset="wide.png 1600w, narrow.png 800w" media="(min-width: 800px)"><source srcset="mid.png 1200w"><img src="fallback.png" alt="wide.png"></picture>`,
+		},
+		{
+			html: `<picture><source srcset="a.png"><img src="fallback.png" data-srcset="b.png 2x"></picture>`,
+			want: `<picture><source srcset="a.png"><img src="fallback.png" data-srcset="b.png 2x" alt="b.png"></picture>`,
+		},
+	}
+
+	for _, c := range cases {
+		got, err := LabelImages(c.html, MissingOnly, labelFunc)
+
+		if err != nil {
+			t.Errorf("got error %s; wanted no error", err.Error())
+		}
+
+		if got != c.want {
+			t.Errorf("LabelImages(%s) == %s, want %s", c.html, got, c.want)
+		}
+	}
+}
+
+func TestBaseHref(t *testing.T) {
+	cases := []struct {
+		html string
+		want string
+	}{
+		{`<html><head><base href="/blog/"></head><body><img src="a.png"></body></html>`, "/blog/"},
+		{`<base target="_blank"><base href="../"><base href="/">`, "../"},
+		{`<img src="a.png">`, ""},
+	}
+
+	for _, c := range cases {
+		if got := baseHref(c.html); got != c.want {
+			t.Errorf("baseHref(%q) == %q, want %q", c.html, got, c.want)
+		}
+	}
+}
+
+func TestPageLanguage(t *testing.T) {
+	cases := []struct {
+		html string
+		want string
+	}{
+		{`<!DOCTYPE html><html lang="es"><body><img src="a.png"></body></html>`, "es"},
+		{`<!-- ja --><html xmlns="http://www.w3.org/1999/xhtml" xml:lang="ja"><body></body></html>`, "ja"},
+		{`<html lang=""><body><div lang="fr"></div></body></html>`, ""},
+		{`<p lang="fr">no html tag</p>`, ""},
+	}
+
+	for _, c := range cases {
+		if got := pageLanguage(c.html); got != c.want {
+			t.Errorf("pageLanguage(%q) == %q, want %q", c.html, got, c.want)
+		}
+	}
+}
+
+func TestCaptionLanguage(t *testing.T) {
+	dir, page := writeTestPage(t, `<html lang="ja"><body><img src="data:image/png;base64,Y2F0"></body></html>`)
+	defer os.RemoveAll(dir)
+
+	page.Language = "es"
+
+	got := ""
+
+	err := page.Caption(func(source caption.Source, prevDescription string, language string) (*caption.Caption, error) {
+		got = language
+		return &caption.Caption{FilePath: source.Name(), Description: "猫"}, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != "ja" {
+		t.Errorf("captioned in %q, want the page's language ja", got)
+	}
+}
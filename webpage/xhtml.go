@@ -0,0 +1,42 @@
+package webpage
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// wellFormed checks if a document parses as XML. HTML entities like &nbsp;
+// are allowed since XHTML documents commonly rely on them.
+func wellFormed(doc string) error {
+	decoder := xml.NewDecoder(strings.NewReader(doc))
+	decoder.Strict = true
+	decoder.Entity = xml.HTMLEntity
+
+	for {
+		_, err := decoder.Token()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// checkXML makes sure labeling didn't turn a well-formed XHTML document into a
+// malformed one.
+func checkXML(original string, labeled string) error {
+	if wellFormed(original) != nil {
+		// nothing to preserve
+		return nil
+	}
+
+	if err := wellFormed(labeled); err != nil {
+		return &XMLError{err}
+	}
+
+	return nil
+}